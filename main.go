@@ -13,6 +13,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,6 +24,8 @@ import (
 	"github.com/klauspost/compress/zstd"
 	"github.com/zmb3/spotify/v2"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.seankhliao.com/earbug/v4/scrobble"
+	"go.seankhliao.com/earbug/v4/store"
 	earbugv4 "go.seankhliao.com/proto/earbug/v4"
 	"go.seankhliao.com/svcrunner/v3/framework"
 	"go.seankhliao.com/svcrunner/v3/observability"
@@ -53,18 +56,42 @@ func main() {
 type Config struct {
 	dataBucket string
 	dataKey    string
+	dataDBKey  string
+	dbPath     string
 	authURL    string
 
-	updateFreq time.Duration
-	exportFreq time.Duration
+	updateFreq     time.Duration
+	exportFreq     time.Duration
+	progressFreq   time.Duration
+	sessionIdleGap time.Duration
+
+	lastfmEnabled    bool
+	lastfmAPIKey     string
+	lastfmAPISecret  string
+	lastfmSessionKey string
+
+	listenbrainzEnabled bool
+	listenbrainzToken   string
 }
 
 func (c *Config) SetFlags(fset *flag.FlagSet) {
 	fset.StringVar(&c.dataBucket, "data.bucket", "gs://earbug-liao-dev", "bucket to load/store data")
-	fset.StringVar(&c.dataKey, "data.key", "ihwa.pb.zstd", "key to load/store data")
+	fset.StringVar(&c.dataKey, "data.key", "ihwa.pb.zstd", "key of the legacy zstd/protobuf blob, imported once into the sqlite store on first run")
+	fset.StringVar(&c.dataDBKey, "data.db.key", "earbug.db", "key to load/checkpoint the sqlite database")
+	fset.StringVar(&c.dbPath, "data.sqlite", "earbug.db", "local path for the sqlite database")
 	fset.StringVar(&c.authURL, "auth.url", "http://earbug-ihwa.badger-altered.ts.net/auth/callback", "auth callback url")
 	fset.DurationVar(&c.updateFreq, "update.interval", 5*time.Minute, "how often to update")
 	fset.DurationVar(&c.exportFreq, "export.interval", 30*time.Minute, "how often to export")
+	fset.DurationVar(&c.progressFreq, "progress.interval", 30*time.Second, "how often to sample the currently playing track's progress")
+	fset.DurationVar(&c.sessionIdleGap, "sessions.idle-gap", 30*time.Minute, "gap between plays after which /sessions starts a new listening session")
+
+	fset.BoolVar(&c.lastfmEnabled, "lastfm.enabled", false, "mirror playbacks to last.fm")
+	fset.StringVar(&c.lastfmAPIKey, "lastfm.api-key", "", "last.fm api key")
+	fset.StringVar(&c.lastfmAPISecret, "lastfm.api-secret", "", "last.fm api secret")
+	fset.StringVar(&c.lastfmSessionKey, "lastfm.session-key", "", "last.fm session key, from the authorize subcommand; overridden by a successful /api/auth/lastfm callback")
+
+	fset.BoolVar(&c.listenbrainzEnabled, "listenbrainz.enabled", false, "mirror playbacks to listenbrainz")
+	fset.StringVar(&c.listenbrainzToken, "listenbrainz.user-token", "", "listenbrainz user token; overridden by a successful /api/auth/listenbrainz callback")
 }
 
 type App struct {
@@ -72,17 +99,42 @@ type App struct {
 	render webstyle.Renderer
 
 	// New
-	http    *http.Client
-	spot    *spotify.Client
-	storemu sync.Mutex
-	store   earbugv4.Store
+	http *http.Client
+	spot *spotify.Client
+
+	store  *store.Store
+	dbPath string
+
+	authmu sync.Mutex
+	auth   earbugv4.Auth
+
+	// progressmu guards trackProgress, the highest progress_ms sampled by
+	// progressLoop for the currently playing track since it was last
+	// confirmed by hUpdate. There's no earbugv4 proto field to persist a
+	// sample against before its play is confirmed (and no .proto source
+	// here to add one), so it's kept in memory and handed off to
+	// store.RecordProgress once PlayerRecentlyPlayed confirms the play it
+	// belongs to. It's scoped to a single play (track id plus an estimated
+	// start time, like server/poller.go's trackedPlay), not just a track
+	// id, so a track replayed before hUpdate next runs doesn't have one
+	// play's progress silently attributed to the other.
+	progressmu    sync.Mutex
+	trackProgress *trackedProgress
 
 	// config
-	dataBucket string
-	dataKey    string
-	authURL    string
+	dataBucket     string
+	dataKey        string
+	dataDBKey      string
+	authURL        string
+	sessionIdleGap time.Duration
 
 	authState atomic.Pointer[AuthState]
+
+	scrobblers            *scrobble.Scrobblers
+	lastfmScrobbler       *scrobble.LastFMScrobbler
+	lastfmAPIKey          string
+	lastfmAPISecret       string
+	listenbrainzScrobbler *scrobble.ListenBrainzScrobbler
 }
 
 func New(ctx context.Context, o *observability.O, conf *Config) (*App, error) {
@@ -94,7 +146,23 @@ func New(ctx context.Context, o *observability.O, conf *Config) (*App, error) {
 		},
 		dataBucket: conf.dataBucket,
 		dataKey:    conf.dataKey,
+		dataDBKey:  conf.dataDBKey,
+		dbPath:     conf.dbPath,
 		authURL:    conf.authURL,
+
+		sessionIdleGap: conf.sessionIdleGap,
+	}
+
+	var scrobblerList []scrobble.Scrobbler
+	if conf.lastfmEnabled {
+		a.lastfmScrobbler = scrobble.NewLastFMScrobbler(a.http, conf.lastfmAPIKey, conf.lastfmAPISecret, conf.lastfmSessionKey)
+		a.lastfmAPIKey = conf.lastfmAPIKey
+		a.lastfmAPISecret = conf.lastfmAPISecret
+		scrobblerList = append(scrobblerList, a.lastfmScrobbler)
+	}
+	if conf.listenbrainzEnabled {
+		a.listenbrainzScrobbler = scrobble.NewListenBrainzScrobbler(a.http, conf.listenbrainzToken)
+		scrobblerList = append(scrobblerList, a.listenbrainzScrobbler)
 	}
 
 	ctx, span := o.T.Start(ctx, "initData")
@@ -105,30 +173,35 @@ func New(ctx context.Context, o *observability.O, conf *Config) (*App, error) {
 		return nil, o.Err(ctx, "open bucket", err)
 	}
 	defer bkt.Close()
-	or, err := bkt.NewReader(ctx, conf.dataKey, nil)
-	if err != nil {
-		return nil, o.Err(ctx, "open object", err)
-	}
-	defer or.Close()
-	zr, err := zstd.NewReader(or)
-	if err != nil {
-		return nil, o.Err(ctx, "new zstd reader", err)
+
+	if b, err := bkt.ReadAll(ctx, conf.dataDBKey); err != nil {
+		o.L.LogAttrs(ctx, slog.LevelWarn, "no existing sqlite checkpoint, starting fresh", slog.String("error", err.Error()))
+	} else if err := os.WriteFile(conf.dbPath, b, 0o600); err != nil {
+		return nil, o.Err(ctx, "write local sqlite db", err)
 	}
-	defer or.Close()
-	b, err := io.ReadAll(zr)
+
+	db, err := store.Open(ctx, conf.dbPath)
 	if err != nil {
-		return nil, o.Err(ctx, "read object", err)
+		return nil, o.Err(ctx, "open sqlite store", err)
 	}
-	err = proto.Unmarshal(b, &a.store)
-	if err != nil {
-		return nil, o.Err(ctx, "unmarshal store", err)
+	a.store = db
+	a.scrobblers = scrobble.New(o.L, a.store, scrobblerList...)
+
+	if conf.dataKey != "" {
+		legacy, err := a.importLegacyBlob(ctx, bkt, conf.dataKey)
+		if err != nil {
+			return nil, o.Err(ctx, "import legacy blob", err)
+		}
+		if legacy.Auth != nil {
+			a.auth = *legacy.Auth
+		}
+	} else {
+		o.L.LogAttrs(ctx, slog.LevelWarn, "no legacy data key provided")
 	}
 
 	var token oauth2.Token
-	if a.store.Auth != nil && len(a.store.Auth.Token) > 0 {
-		rawToken := a.store.Auth.Token // new value
-		err = json.Unmarshal(rawToken, &token)
-		if err != nil {
+	if len(a.auth.Token) > 0 {
+		if err := json.Unmarshal(a.auth.Token, &token); err != nil {
 			return nil, o.Err(ctx, "unmarshal oauth token", err)
 		}
 	} else {
@@ -137,25 +210,72 @@ func New(ctx context.Context, o *observability.O, conf *Config) (*App, error) {
 
 	httpClient := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
 	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
-	as := NewAuthState(a.store.Auth.ClientId, a.store.Auth.ClientSecret, "")
+	as := NewAuthState(a.auth.ClientId, a.auth.ClientSecret, "")
 	httpClient = as.conf.Client(ctx, &token)
 	a.spot = spotify.New(httpClient)
 
 	go a.exportLoop(ctx, conf.exportFreq)
 	go a.updateLoop(ctx, conf.updateFreq)
+	go a.progressLoop(ctx, conf.progressFreq)
 
 	return a, nil
 }
 
+// importLegacyBlob seeds the sqlite store from the previous single-blob
+// zstd/protobuf export, so existing deployments migrate without losing
+// history, and hands back its Auth regardless, since that's the only
+// place the OAuth token/client credentials are persisted across restarts
+// (there's no sqlite column for them). The store.Import pass itself only
+// runs once, gated on the sqlite store being empty, rather than
+// redownloading and reinserting the full legacy blob (idempotently, but
+// at ever-growing cost as history accumulates) on every restart.
+func (a *App) importLegacyBlob(ctx context.Context, bkt *blob.Bucket, key string) (*earbugv4.Store, error) {
+	or, err := bkt.NewReader(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer or.Close()
+	zr, err := zstd.NewReader(or)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	var legacy earbugv4.Store
+	if err := proto.Unmarshal(b, &legacy); err != nil {
+		return nil, err
+	}
+
+	empty, err := a.store.Empty(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		if err := a.store.Import(ctx, &legacy); err != nil {
+			return nil, err
+		}
+	}
+	return &legacy, nil
+}
+
 func (a *App) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/", a.handleIndex)
 	mux.HandleFunc("/artists", a.handleArtists)
 	mux.HandleFunc("/playbacks", a.handlePlaybacks)
 	mux.HandleFunc("/tracks", a.handleTracks)
+	mux.HandleFunc("/playbacks.m3u", a.handlePlaybacksM3U)
+	mux.HandleFunc("/playbacks.jspf", a.handlePlaybacksJSPF)
+	mux.HandleFunc("/sessions", a.handleSessions)
 	mux.HandleFunc("/api/export", a.hExport)
 	mux.HandleFunc("/api/auth", a.hAuthorize)
 	mux.HandleFunc("/api/update", a.hUpdate)
 	mux.HandleFunc("/auth/callback", a.hAuthCallback)
+	mux.HandleFunc("/api/auth/lastfm", a.hAuthCallbackLastFM)
+	mux.HandleFunc("/api/auth/listenbrainz", a.hAuthCallbackListenBrainz)
 	mux.HandleFunc("/-/ready", func(rw http.ResponseWriter, r *http.Request) { rw.Write([]byte("ok")) })
 }
 
@@ -164,22 +284,19 @@ func (a *App) hAuthorize(rw http.ResponseWriter, r *http.Request) {
 	defer span.End()
 
 	clientID, clientSecret := func() (clientID, clientSecret string) {
-		a.storemu.Lock()
-		defer a.storemu.Unlock()
+		a.authmu.Lock()
+		defer a.authmu.Unlock()
 		clientID = r.FormValue("client_id")
-		if clientID == "" && (a.store.Auth != nil && a.store.Auth.ClientId != "") {
-			clientID = a.store.Auth.ClientId
+		if clientID == "" && a.auth.ClientId != "" {
+			clientID = a.auth.ClientId
 		} else {
-			if a.store.Auth == nil {
-				a.store.Auth = &earbugv4.Auth{}
-			}
-			a.store.Auth.ClientId = clientID
+			a.auth.ClientId = clientID
 		}
 		clientSecret = r.FormValue("client_secret")
-		if clientSecret == "" && (a.store.Auth != nil && a.store.Auth.ClientSecret != "") {
-			clientSecret = a.store.Auth.ClientSecret
+		if clientSecret == "" && a.auth.ClientSecret != "" {
+			clientSecret = a.auth.ClientSecret
 		} else {
-			a.store.Auth.ClientSecret = clientSecret
+			a.auth.ClientSecret = clientSecret
 		}
 		return
 	}()
@@ -217,15 +334,66 @@ func (a *App) hAuthCallback(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	func() {
-		a.storemu.Lock()
-		defer a.storemu.Unlock()
-		a.store.Auth.Token = tokenMarshaled
+		a.authmu.Lock()
+		defer a.authmu.Unlock()
+		a.auth.Token = tokenMarshaled
 		a.spot = spotClient
 	}()
 
 	rw.Write([]byte("success"))
 }
 
+// hAuthCallbackLastFM completes the last.fm "desktop" auth flow: given the
+// token granted by the user at last.fm's auth URL, exchange it for a
+// session key and hand it to the running scrobbler.
+func (a *App) hAuthCallbackLastFM(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := a.o.T.Start(r.Context(), "hAuthCallbackLastFM")
+	defer span.End()
+
+	if a.lastfmScrobbler == nil {
+		a.o.HTTPErr(ctx, "last.fm scrobbling not enabled", errors.New("missing -lastfm.enabled"), rw, http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		a.o.HTTPErr(ctx, "missing token", errors.New("token is required"), rw, http.StatusBadRequest)
+		return
+	}
+
+	sessionKey, err := scrobble.LastFMGetSession(ctx, a.lastfmAPIKey, a.lastfmAPISecret, token)
+	if err != nil {
+		a.o.HTTPErr(ctx, "get last.fm session", err, rw, http.StatusBadGateway)
+		return
+	}
+	a.lastfmScrobbler.SetSessionKey(sessionKey)
+
+	rw.Write([]byte("success"))
+}
+
+// hAuthCallbackListenBrainz hands a freshly generated ListenBrainz user
+// token to the running scrobbler. ListenBrainz has no OAuth redirect of
+// its own, so unlike hAuthCallback this is just the token, pasted by the
+// user from their ListenBrainz profile settings.
+func (a *App) hAuthCallbackListenBrainz(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := a.o.T.Start(r.Context(), "hAuthCallbackListenBrainz")
+	defer span.End()
+
+	if a.listenbrainzScrobbler == nil {
+		a.o.HTTPErr(ctx, "listenbrainz scrobbling not enabled", errors.New("missing -listenbrainz.enabled"), rw, http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("user_token")
+	if token == "" {
+		a.o.HTTPErr(ctx, "missing user_token", errors.New("user_token is required"), rw, http.StatusBadRequest)
+		return
+	}
+	a.listenbrainzScrobbler.SetUserToken(token)
+
+	rw.Write([]byte("success"))
+}
+
 type AuthState struct {
 	state string
 	conf  *oauth2.Config
@@ -250,17 +418,15 @@ func NewAuthState(clientID, clientSecret, redirectURL string) *AuthState {
 	}
 }
 
+// hExport checkpoints the local sqlite database back to the bucket, so a
+// fresh instance can pick up from where this one left off.
 func (a *App) hExport(rw http.ResponseWriter, r *http.Request) {
 	ctx, span := a.o.T.Start(r.Context(), "Export")
 	defer span.End()
 
-	b, err := func() ([]byte, error) {
-		a.storemu.Lock()
-		defer a.storemu.Unlock()
-		return proto.Marshal(&a.store)
-	}()
+	b, err := os.ReadFile(a.dbPath)
 	if err != nil {
-		a.o.HTTPErr(ctx, "marshal store", err, rw, http.StatusInternalServerError)
+		a.o.HTTPErr(ctx, "read sqlite db", err, rw, http.StatusInternalServerError)
 		return
 	}
 
@@ -269,22 +435,10 @@ func (a *App) hExport(rw http.ResponseWriter, r *http.Request) {
 		a.o.HTTPErr(ctx, "open destination bucket", err, rw, http.StatusFailedDependency)
 		return
 	}
+	defer bkt.Close()
 
-	ow, err := bkt.NewWriter(ctx, a.dataKey, nil)
-	if err != nil {
-		a.o.HTTPErr(ctx, "open destination key", err, rw, http.StatusFailedDependency)
-		return
-	}
-	defer ow.Close()
-	zw, err := zstd.NewWriter(ow)
-	if err != nil {
-		a.o.HTTPErr(ctx, "new zstd writer", err, rw, http.StatusFailedDependency)
-		return
-	}
-	defer zw.Close()
-	_, err = io.Copy(zw, bytes.NewReader(b))
-	if err != nil {
-		a.o.HTTPErr(ctx, "write store", err, rw, http.StatusFailedDependency)
+	if err := bkt.WriteAll(ctx, a.dataDBKey, b, nil); err != nil {
+		a.o.HTTPErr(ctx, "write sqlite db", err, rw, http.StatusFailedDependency)
 		return
 	}
 	fmt.Fprintln(rw, "ok")
@@ -302,35 +456,46 @@ func (a *App) hUpdate(rw http.ResponseWriter, r *http.Request) {
 
 	var added int
 	for _, item := range items {
-		ts := item.PlayedAt.Format(time.RFC3339Nano)
-		if _, ok := a.store.Playbacks[ts]; !ok {
-			added++
-			a.store.Playbacks[ts] = &earbugv4.Playback{
-				TrackId:     item.Track.ID.String(),
-				TrackUri:    string(item.Track.URI),
-				ContextType: item.PlaybackContext.Type,
-				ContextUri:  string(item.PlaybackContext.URI),
-			}
+		t := trackFromSimpleTrack(item.Track)
+		if err := a.store.PutTrack(ctx, t); err != nil {
+			a.o.HTTPErr(ctx, "put track", err, rw, http.StatusInternalServerError)
+			return
 		}
 
-		if _, ok := a.store.Tracks[item.Track.ID.String()]; !ok {
-			t := &earbugv4.Track{
-				Id:       item.Track.ID.String(),
-				Uri:      string(item.Track.URI),
-				Type:     item.Track.Type,
-				Name:     item.Track.Name,
-				Duration: durationpb.New(item.Track.TimeDuration()),
+		isNew, err := a.store.PutPlayback(ctx, "spotify", item.PlayedAt, &earbugv4.Playback{
+			TrackId:     item.Track.ID.String(),
+			TrackUri:    string(item.Track.URI),
+			ContextType: item.PlaybackContext.Type,
+			ContextUri:  string(item.PlaybackContext.URI),
+		})
+		if err != nil {
+			a.o.HTTPErr(ctx, "put playback", err, rw, http.StatusInternalServerError)
+			return
+		}
+
+		if observed, ok := func() (time.Duration, bool) {
+			a.progressmu.Lock()
+			defer a.progressmu.Unlock()
+			tp := a.trackProgress
+			if tp == nil || tp.trackID != item.Track.ID.String() || absDuration(tp.startedAt.Sub(item.PlayedAt)) > progressMatchTolerance {
+				return 0, false
 			}
-			for _, artist := range item.Track.Artists {
-				t.Artists = append(t.Artists, &earbugv4.Artist{
-					Id:   artist.ID.String(),
-					Uri:  string(artist.URI),
-					Name: artist.Name,
-				})
+			a.trackProgress = nil
+			return tp.progress, true
+		}(); ok {
+			if err := a.store.RecordProgress(ctx, "spotify", item.PlayedAt, observed); err != nil {
+				a.o.HTTPErr(ctx, "record progress", err, rw, http.StatusInternalServerError)
+				return
 			}
-			a.store.Tracks[item.Track.ID.String()] = t
 		}
+
+		if !isNew {
+			continue
+		}
+		added++
+		a.scrobblers.Scrobble(ctx, item.PlayedAt, t)
 	}
+	a.scrobblers.Retry(ctx)
 	fmt.Fprintln(rw, "added", added)
 }
 
@@ -383,6 +548,9 @@ func (a *App) handleIndex(rw http.ResponseWriter, r *http.Request) {
 - [artists by plays](/artists?sort=plays)
 - [artists by time](/artists?sort=time)
 - [playbacks](/playbacks)
+- [playbacks as m3u](/playbacks.m3u)
+- [playbacks as jspf](/playbacks.jspf)
+- [sessions](/sessions)
 - [tracks by plays](/tracks?sort=plays)
 - [tracks by time](/tracks?sort=time)
 `
@@ -657,52 +825,36 @@ type Playback struct {
 	StartTime    time.Time
 	PlaybackTime time.Duration
 	Track        *earbugv4.Track
+	ContextURI   string
 }
 
 func (a *App) getPlaybacks(ctx context.Context, o getPlaybacksOptions) []Playback {
-	_, span := a.o.T.Start(ctx, "getPlaybacks")
+	ctx, span := a.o.T.Start(ctx, "getPlaybacks")
 	defer span.End()
 
-	var plays []Playback
-
-	a.storemu.Lock()
-	defer a.storemu.Unlock()
-	for ts, play := range a.store.Playbacks {
-		startTime, _ := time.Parse(time.RFC3339, ts)
-
-		if !o.From.IsZero() && o.From.After(startTime) {
-			continue
-		} else if !o.To.IsZero() && o.To.Before(startTime) {
-			continue
-		}
-
-		track := a.store.Tracks[play.TrackId]
-
-		if o.Track != "" && !strings.Contains(strings.ToLower(track.Name), strings.ToLower(o.Track)) {
-			continue
-		}
-
-		artistMatch := o.Artist == ""
-		for _, artist := range track.Artists {
-			if !artistMatch && strings.Contains(strings.ToLower(artist.Name), strings.ToLower(o.Artist)) {
-				artistMatch = true
-			}
-		}
-		if !artistMatch {
-			continue
-		}
-
-		plays = append(plays, Playback{
-			StartTime: startTime,
-			Track:     track,
-		})
+	rows, err := a.store.ListPlaybacks(ctx, store.Options{
+		From:   o.From,
+		To:     o.To,
+		Artist: o.Artist,
+		Track:  o.Track,
+	})
+	if err != nil {
+		a.o.Err(ctx, "list playbacks", err)
+		return nil
 	}
 
-	sort.Slice(plays, func(i, j int) bool {
-		return plays[i].StartTime.After(plays[j].StartTime)
-	})
+	plays := make([]Playback, len(rows))
+	for i, row := range rows {
+		plays[i] = Playback{StartTime: row.StartTime, Track: row.Track, ContextURI: row.ContextURI}
+	}
 
 	for i := range plays {
+		if observed := rows[i].ObservedDuration; observed > 0 {
+			// A currently-playing sample confirmed how much was actually
+			// listened to, so skip the duration heuristic entirely.
+			plays[i].PlaybackTime = observed
+			continue
+		}
 		plays[i].PlaybackTime = plays[i].Track.Duration.AsDuration()
 		if i > 0 {
 			gap := plays[i-1].StartTime.Sub(plays[i].StartTime)
@@ -760,3 +912,102 @@ func (a *App) update(ctx context.Context) {
 	rec := httptest.NewRecorder()
 	a.hUpdate(rec, req)
 }
+
+// progressLoop samples the currently playing track's progress on an
+// interval much shorter than updateLoop's, so a skipped or paused track's
+// true listened duration survives to be picked up once hUpdate later
+// confirms the play via PlayerRecentlyPlayed.
+func (a *App) progressLoop(ctx context.Context, dur time.Duration) {
+	ticker := time.NewTicker(dur)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		a.sampleProgress(ctx)
+	}
+}
+
+func (a *App) sampleProgress(ctx context.Context) {
+	ctx, span := a.o.T.Start(ctx, "sampleProgress")
+	defer span.End()
+
+	current, err := a.spot.PlayerCurrentlyPlaying(ctx)
+	if err != nil {
+		a.o.L.LogAttrs(ctx, slog.LevelWarn, "get currently playing", slog.String("error", err.Error()))
+		return
+	}
+	if !current.Playing || current.Item == nil {
+		return
+	}
+
+	trackID := current.Item.ID.String()
+	progress := time.Duration(current.Progress) * time.Millisecond
+
+	a.progressmu.Lock()
+	tp := a.trackProgress
+	// A different track, or progress regressing while the track id is
+	// unchanged (a replay), means this is a new play; estimate its start
+	// the same way server/poller.go's poll does, so hUpdate can later
+	// match this sample to the right PlayerRecentlyPlayed item instead of
+	// whichever play of the same track happened to run last.
+	newPlay := tp == nil || tp.trackID != trackID || progress < tp.progress
+	if newPlay {
+		tp = &trackedProgress{trackID: trackID, startedAt: time.Now().Add(-progress), progress: progress}
+		a.trackProgress = tp
+	} else if progress > tp.progress {
+		tp.progress = progress
+	}
+	a.progressmu.Unlock()
+
+	if newPlay {
+		a.scrobblers.NowPlaying(ctx, trackFromSimpleTrack(current.Item.SimpleTrack))
+	}
+}
+
+// trackedProgress is the highest progress_ms sampled so far for one play,
+// scoped by an estimated start time (not just a track id) so a track
+// replayed before hUpdate next runs doesn't have its progress attributed
+// to the wrong play.
+type trackedProgress struct {
+	trackID   string
+	startedAt time.Time
+	progress  time.Duration
+}
+
+// progressMatchTolerance bounds how far a sampled play's estimated start
+// time may drift from PlayerRecentlyPlayed's own PlayedAt and still be
+// considered the same play; it only needs to absorb progressLoop's own
+// sampling interval, not a full replay's worth of drift.
+const progressMatchTolerance = time.Minute
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// trackFromSimpleTrack converts a spotify SimpleTrack (the type embedded
+// in both FullTrack and RecentlyPlayedItem) into the stored earbugv4.Track
+// shape, shared by hUpdate and sampleProgress so a track looks the same
+// regardless of which Spotify call observed it.
+func trackFromSimpleTrack(t spotify.SimpleTrack) *earbugv4.Track {
+	track := &earbugv4.Track{
+		Id:       t.ID.String(),
+		Uri:      string(t.URI),
+		Type:     t.Type,
+		Name:     t.Name,
+		Duration: durationpb.New(t.TimeDuration()),
+	}
+	for _, artist := range t.Artists {
+		track.Artists = append(track.Artists, &earbugv4.Artist{
+			Id:   artist.ID.String(),
+			Uri:  string(artist.URI),
+			Name: artist.Name,
+		})
+	}
+	return track
+}
@@ -1,3 +1,11 @@
+// Package observability is this repo's own logging/tracing setup, used by
+// subcommands/authorize. subcommands/serve and main.go each build their *O
+// from a different, external observability package instead
+// (go.seankhliao.com/svcrunner/v2/observability via tshttp.New, and
+// go.seankhliao.com/svcrunner/v3/observability, respectively) predating
+// this one and vendored with no local source to add flags to; LogFormat/
+// LogAddSource below only take effect for authorize, not for serve's or
+// main's own logging.
 package observability
 
 import (
@@ -19,12 +27,16 @@ import (
 )
 
 type Config struct {
-	LogOutput io.Writer
-	LogLevel  slog.Level
+	LogOutput    io.Writer
+	LogLevel     slog.Level
+	LogFormat    string
+	LogAddSource bool
 }
 
 func (c *Config) SetFlags(f *flag.FlagSet) {
 	f.TextVar(&c.LogLevel, "log.level", slog.LevelInfo, "log level: debug|info|warn|error")
+	f.StringVar(&c.LogFormat, "log.format", "json", "log handler: json|text|console")
+	f.BoolVar(&c.LogAddSource, "log.addSource", false, "add source file and line to log records")
 }
 
 type O struct {
@@ -49,13 +61,24 @@ func New(c Config) *O {
 	}()
 
 	logOptions := &slog.HandlerOptions{
-		Level: c.LogLevel,
+		Level:     c.LogLevel,
+		AddSource: c.LogAddSource,
 	}
 	out := c.LogOutput
 	if out == nil {
 		out = os.Stdout
 	}
-	o.H = logOptions.NewJSONHandler(out)
+	switch c.LogFormat {
+	case "text", "console":
+		// console is a plain text handler too: there's no colorized
+		// dev-console handler in x/exp/slog, and adding one is more
+		// machinery than this binary needs.
+		o.H = logOptions.NewTextHandler(out)
+	case "json":
+		fallthrough
+	default:
+		o.H = logOptions.NewJSONHandler(out)
+	}
 	o.L = slog.New(o.H)
 
 	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" {
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	"go.seankhliao.com/earbug/v4/playlist"
+)
+
+// toPlaylistTracks adapts getPlaybacks's Playback rows into the shape the
+// shared playlist package renders, since Playback itself carries an
+// earbugv4.Track, not the plain fields playlist.Track needs.
+func toPlaylistTracks(plays []Playback) []playlist.Track {
+	out := make([]playlist.Track, len(plays))
+	for i, p := range plays {
+		var artists []string
+		for _, artist := range p.Track.Artists {
+			artists = append(artists, artist.Name)
+		}
+		out[i] = playlist.Track{
+			Name:      p.Track.Name,
+			Artists:   artists,
+			SpotifyID: p.Track.Id,
+			Duration:  p.Track.Duration.AsDuration(),
+		}
+	}
+	return out
+}
+
+// handlePlaybacksM3U and handlePlaybacksJSPF render the filtered playback
+// listing as a playlist, so it can be re-imported into Spotify or other
+// players, the same way subcommands/serve's handlePlaylistExport does.
+func (a *App) handlePlaybacksM3U(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := a.o.T.Start(r.Context(), "handlePlaybacksM3U")
+	defer span.End()
+
+	plays := a.getPlaybacks(ctx, optionsFromRequest(r))
+	rw.Header().Set("Content-Type", "audio/x-mpegurl")
+	rw.Header().Set("Content-Disposition", `attachment; filename="earbug.m3u"`)
+	playlist.WriteM3U(rw, toPlaylistTracks(plays))
+}
+
+func (a *App) handlePlaybacksJSPF(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := a.o.T.Start(r.Context(), "handlePlaybacksJSPF")
+	defer span.End()
+
+	plays := a.getPlaybacks(ctx, optionsFromRequest(r))
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Disposition", `attachment; filename="earbug.jspf"`)
+	playlist.WriteJSPF(rw, toPlaylistTracks(plays))
+}
@@ -0,0 +1,65 @@
+// Package playlist renders a playback listing as an m3u or JSPF playlist
+// file, shared by main.go's and subcommands/serve's playlist-export
+// handlers so the rendering logic isn't maintained twice; each caller
+// adapts its own store-backed Playback type into a Track before calling
+// WriteM3U/WriteJSPF.
+package playlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Track is the minimal shape WriteM3U/WriteJSPF need from a played track.
+type Track struct {
+	Name      string
+	Artists   []string
+	SpotifyID string
+	Duration  time.Duration
+}
+
+// WriteM3U writes tracks as an extended m3u playlist.
+func WriteM3U(w io.Writer, tracks []Track) {
+	fmt.Fprintln(w, "#EXTM3U")
+	for _, t := range tracks {
+		fmt.Fprintf(w, "#EXTINF:%d,%s - %s\n", int(t.Duration.Seconds()), strings.Join(t.Artists, ", "), t.Name)
+		fmt.Fprintf(w, "spotify:track:%s\n", t.SpotifyID)
+	}
+}
+
+// jspf mirrors the JSON Shareable Playlist Format: https://www.xspf.org/jspf/
+type jspf struct {
+	Playlist jspfPlaylist `json:"playlist"`
+}
+
+type jspfPlaylist struct {
+	Title string      `json:"title"`
+	Track []jspfTrack `json:"track"`
+}
+
+type jspfTrack struct {
+	Title      string   `json:"title"`
+	Creator    string   `json:"creator"`
+	Identifier []string `json:"identifier"`
+	Location   []string `json:"location"`
+	Duration   int64    `json:"duration"`
+}
+
+// WriteJSPF writes tracks as a JSPF playlist.
+func WriteJSPF(w io.Writer, tracks []Track) {
+	pl := jspf{Playlist: jspfPlaylist{Title: "earbug"}}
+	for _, t := range tracks {
+		location := fmt.Sprintf("spotify:track:%s", t.SpotifyID)
+		pl.Playlist.Track = append(pl.Playlist.Track, jspfTrack{
+			Title:      t.Name,
+			Creator:    strings.Join(t.Artists, ", "),
+			Identifier: []string{location},
+			Location:   []string{location},
+			Duration:   t.Duration.Milliseconds(),
+		})
+	}
+	json.NewEncoder(w).Encode(pl)
+}
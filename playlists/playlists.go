@@ -0,0 +1,262 @@
+// Package playlists generates curated Spotify playlists from a user's
+// captured listening history (an earbugv3.Store) and writes them back to
+// the user's own account.
+package playlists
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	earbugv3 "go.seankhliao.com/earbug/v3/pb/earbug/v3"
+)
+
+// Generator picks the tracks for one named playlist from a user's stored
+// history. Name is the playlist's stable title: the Scheduler looks for
+// a playlist with this name on every run and replaces its tracks instead
+// of creating a duplicate.
+type Generator interface {
+	Name() string
+	Generate(store *earbugv3.Store, now time.Time) []spotify.ID
+}
+
+// trackStats is the play-count/first-play/last-play summary Rediscover
+// and NewInRotation both need; computed once per run from store.Playbacks
+// since earbugv3.Track itself carries none of this.
+type trackStats struct {
+	plays     int
+	firstPlay time.Time
+	lastPlay  time.Time
+}
+
+func computeStats(store *earbugv3.Store) map[string]trackStats {
+	stats := map[string]trackStats{}
+	for ts, p := range store.Playbacks {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			continue
+		}
+		s := stats[p.TrackId]
+		s.plays++
+		if s.firstPlay.IsZero() || t.Before(s.firstPlay) {
+			s.firstPlay = t
+		}
+		if t.After(s.lastPlay) {
+			s.lastPlay = t
+		}
+		stats[p.TrackId] = s
+	}
+	return stats
+}
+
+// TopTracks ranks tracks by play count within the trailing Window, ties
+// broken by most-recent play.
+type TopTracks struct {
+	title  string
+	Window time.Duration
+}
+
+func NewTopTracks(name string, window time.Duration) *TopTracks {
+	return &TopTracks{title: name, Window: window}
+}
+
+func (g *TopTracks) Name() string { return g.title }
+
+func (g *TopTracks) Generate(store *earbugv3.Store, now time.Time) []spotify.ID {
+	since := now.Add(-g.Window)
+	counts := map[string]int{}
+	last := map[string]time.Time{}
+	for ts, p := range store.Playbacks {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil || t.Before(since) {
+			continue
+		}
+		counts[p.TrackId]++
+		if t.After(last[p.TrackId]) {
+			last[p.TrackId] = t
+		}
+	}
+
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if counts[ids[i]] != counts[ids[j]] {
+			return counts[ids[i]] > counts[ids[j]]
+		}
+		return last[ids[i]].After(last[ids[j]])
+	})
+
+	return toSpotifyIDs(ids)
+}
+
+// Rediscover surfaces tracks the user used to play regularly but hasn't
+// touched in at least Idle.
+type Rediscover struct {
+	Idle     time.Duration
+	MinPlays int
+}
+
+func NewRediscover() *Rediscover {
+	return &Rediscover{Idle: 180 * 24 * time.Hour, MinPlays: 3}
+}
+
+func (g *Rediscover) Name() string { return "rediscover" }
+
+func (g *Rediscover) Generate(store *earbugv3.Store, now time.Time) []spotify.ID {
+	stats := computeStats(store)
+	var ids []string
+	for id, s := range stats {
+		if s.plays >= g.MinPlays && now.Sub(s.lastPlay) >= g.Idle {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return stats[ids[i]].lastPlay.Before(stats[ids[j]].lastPlay) })
+	return toSpotifyIDs(ids)
+}
+
+// NewInRotation surfaces tracks first played within the last Since that
+// already have at least MinPlays, i.e. new enough to be a discovery but
+// already played often enough to be a habit, not a one-off skip-through.
+type NewInRotation struct {
+	Since    time.Duration
+	MinPlays int
+}
+
+func NewNewInRotation() *NewInRotation {
+	return &NewInRotation{Since: 14 * 24 * time.Hour, MinPlays: 3}
+}
+
+func (g *NewInRotation) Name() string { return "new-in-rotation" }
+
+func (g *NewInRotation) Generate(store *earbugv3.Store, now time.Time) []spotify.ID {
+	stats := computeStats(store)
+	cutoff := now.Add(-g.Since)
+	var ids []string
+	for id, s := range stats {
+		if s.plays >= g.MinPlays && s.firstPlay.After(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return stats[ids[i]].plays > stats[ids[j]].plays })
+	return toSpotifyIDs(ids)
+}
+
+func toSpotifyIDs(ids []string) []spotify.ID {
+	out := make([]spotify.ID, len(ids))
+	for i, id := range ids {
+		out[i] = spotify.ID(id)
+	}
+	return out
+}
+
+// Scheduler writes each Generator's output back to the user's Spotify
+// account, creating the playlist once and idempotently replacing its
+// tracks by stable name on every later run.
+type Scheduler struct {
+	Generators []Generator
+}
+
+func NewScheduler(generators ...Generator) *Scheduler {
+	return &Scheduler{Generators: generators}
+}
+
+// Run generates and writes every configured playlist, using client
+// (already scoped to the target user, with playlist-modify scopes) and
+// userID, the target Spotify account's own id. If kinds is non-empty,
+// only generators whose Name is in kinds run.
+func (s *Scheduler) Run(ctx context.Context, client *spotify.Client, userID string, store *earbugv3.Store, now time.Time, kinds []string) error {
+	want := map[string]bool{}
+	for _, k := range kinds {
+		want[k] = true
+	}
+
+	for _, g := range s.Generators {
+		if len(want) > 0 && !want[g.Name()] {
+			continue
+		}
+		ids := g.Generate(store, now)
+		if err := s.writePlaylist(ctx, client, userID, g.Name(), ids); err != nil {
+			return fmt.Errorf("write playlist %s: %w", g.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) writePlaylist(ctx context.Context, client *spotify.Client, userID, name string, ids []spotify.ID) error {
+	playlistID, err := s.findPlaylist(ctx, client, userID, name)
+	if err != nil {
+		return fmt.Errorf("find playlist: %w", err)
+	}
+	if playlistID == "" {
+		pl, err := client.CreatePlaylistForUser(ctx, userID, name, "generated by earbug; edits here are overwritten on the next run", false, false)
+		if err != nil {
+			return fmt.Errorf("create playlist: %w", err)
+		}
+		playlistID = pl.ID
+	}
+	for i, chunk := range chunkIDs(ids, maxPlaylistTracksPerRequest) {
+		if i == 0 {
+			// ReplacePlaylistTracks with zero ids empties the playlist, so
+			// this still runs for an empty first chunk.
+			if err := client.ReplacePlaylistTracks(ctx, playlistID, chunk...); err != nil {
+				return fmt.Errorf("replace tracks: %w", err)
+			}
+			continue
+		}
+		if _, err := client.AddTracksToPlaylist(ctx, playlistID, chunk...); err != nil {
+			return fmt.Errorf("add tracks (chunk %d): %w", i, err)
+		}
+	}
+	return nil
+}
+
+// maxPlaylistTracksPerRequest is Spotify's limit on ids accepted by a
+// single replace/add-tracks call.
+const maxPlaylistTracksPerRequest = 100
+
+// chunkIDs splits ids into runs of at most n, always returning at least
+// one (possibly empty) chunk so writePlaylist still clears a playlist
+// whose generator now returns zero tracks.
+func chunkIDs(ids []spotify.ID, n int) [][]spotify.ID {
+	if len(ids) == 0 {
+		return [][]spotify.ID{nil}
+	}
+	var chunks [][]spotify.ID
+	for len(ids) > 0 {
+		end := n
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunks = append(chunks, ids[:end])
+		ids = ids[end:]
+	}
+	return chunks
+}
+
+// findPlaylist looks for a playlist named name already owned by userID,
+// so reruns replace its tracks instead of creating a duplicate every
+// time this is scheduled.
+func (s *Scheduler) findPlaylist(ctx context.Context, client *spotify.Client, userID, name string) (spotify.ID, error) {
+	page, err := client.GetPlaylistsForUser(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("list playlists: %w", err)
+	}
+	for {
+		for _, pl := range page.Playlists {
+			if pl.Name == name {
+				return pl.ID, nil
+			}
+		}
+		err := client.NextPage(ctx, page)
+		if err == spotify.ErrNoMorePages {
+			break
+		} else if err != nil {
+			return "", fmt.Errorf("next page: %w", err)
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,361 @@
+// Package scrobble mirrors playbacks to external listening-history
+// services (Last.fm, ListenBrainz). It's shared by main.go's SQLite-backed
+// app and subcommands/serve's Connect-RPC server, since both fan out the
+// same earbugv4.Track to the same scrobblers and need the same persisted
+// retry queue; previously each carried its own byte-for-byte copy of this
+// logic.
+package scrobble
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+)
+
+// Scrobbler mirrors a playback to an external listening-history service.
+type Scrobbler interface {
+	// Name identifies this scrobbler in the persisted pending-retry queue.
+	Name() string
+	// NowPlaying reports that a track has just started playing.
+	NowPlaying(ctx context.Context, track *earbugv4.Track) error
+	// Scrobble reports a completed playback.
+	Scrobble(ctx context.Context, startTime time.Time, track *earbugv4.Track) error
+}
+
+// PendingScrobble is one previously failed scrobble awaiting retry.
+type PendingScrobble struct {
+	StartTime time.Time
+	Track     *earbugv4.Track
+}
+
+// PendingStore persists scrobbles that failed delivery, so they survive a
+// process restart instead of only living in an in-memory retry queue.
+// *store.Store implements this.
+type PendingStore interface {
+	QueuePendingScrobble(ctx context.Context, scrobbler string, startTime time.Time, track *earbugv4.Track) error
+	ListPendingScrobbles(ctx context.Context, scrobbler string) ([]PendingScrobble, error)
+	DeletePendingScrobble(ctx context.Context, scrobbler string, startTime time.Time) error
+}
+
+// Scrobblers fans out newly observed playbacks to the enabled Scrobbler
+// implementations. A failed Scrobble is persisted via store rather than
+// dropped, so Retry can flush it on a later update tick even across a
+// process restart.
+type Scrobblers struct {
+	log   *slog.Logger
+	store PendingStore
+	all   []Scrobbler
+}
+
+func New(log *slog.Logger, store PendingStore, all ...Scrobbler) *Scrobblers {
+	return &Scrobblers{log: log, store: store, all: all}
+}
+
+// NowPlaying reports a track that has just started playing to every
+// enabled scrobbler; failures are logged, not queued, since a now-playing
+// update is informational and stale by the time a retry would land.
+func (s *Scrobblers) NowPlaying(ctx context.Context, track *earbugv4.Track) {
+	for _, sc := range s.all {
+		if err := sc.NowPlaying(ctx, track); err != nil {
+			s.log.LogAttrs(ctx, slog.LevelWarn, "now playing", slog.String("error", err.Error()), slog.String("track", track.Name))
+		}
+	}
+}
+
+func (s *Scrobblers) Scrobble(ctx context.Context, startTime time.Time, track *earbugv4.Track) {
+	for _, sc := range s.all {
+		s.submit(ctx, sc, startTime, track)
+	}
+}
+
+// Retry flushes every scrobble still queued in store, oldest first, for
+// each enabled scrobbler.
+func (s *Scrobblers) Retry(ctx context.Context) {
+	for _, sc := range s.all {
+		pending, err := s.store.ListPendingScrobbles(ctx, sc.Name())
+		if err != nil {
+			s.log.LogAttrs(ctx, slog.LevelWarn, "list pending scrobbles", slog.String("error", err.Error()), slog.String("scrobbler", sc.Name()))
+			continue
+		}
+		for _, p := range pending {
+			s.submit(ctx, sc, p.StartTime, p.Track)
+		}
+	}
+}
+
+func (s *Scrobblers) submit(ctx context.Context, sc Scrobbler, startTime time.Time, track *earbugv4.Track) {
+	err := sc.Scrobble(ctx, startTime, track)
+	if err != nil {
+		s.log.LogAttrs(ctx, slog.LevelWarn, "scrobble failed, queued for retry", slog.String("error", err.Error()), slog.String("track", track.Name))
+		if qerr := s.store.QueuePendingScrobble(ctx, sc.Name(), startTime, track); qerr != nil {
+			s.log.LogAttrs(ctx, slog.LevelError, "queue pending scrobble", slog.String("error", qerr.Error()), slog.String("scrobbler", sc.Name()))
+		}
+		return
+	}
+	if derr := s.store.DeletePendingScrobble(ctx, sc.Name(), startTime); derr != nil {
+		s.log.LogAttrs(ctx, slog.LevelWarn, "delete pending scrobble", slog.String("error", derr.Error()), slog.String("scrobbler", sc.Name()))
+	}
+}
+
+// LastFMScrobbler submits now-playing/scrobble updates to Last.fm using a
+// pre-authorized session key. The session key can arrive later, via
+// /api/auth/lastfm, so it's guarded by a mutex rather than fixed at
+// construction.
+type LastFMScrobbler struct {
+	http      *http.Client
+	apiKey    string
+	apiSecret string
+
+	mu         sync.RWMutex
+	sessionKey string
+}
+
+func NewLastFMScrobbler(httpClient *http.Client, apiKey, apiSecret, sessionKey string) *LastFMScrobbler {
+	return &LastFMScrobbler{http: httpClient, apiKey: apiKey, apiSecret: apiSecret, sessionKey: sessionKey}
+}
+
+// SetSessionKey updates the session key used for subsequent calls, once
+// the user has completed the Last.fm desktop auth flow.
+func (l *LastFMScrobbler) SetSessionKey(sessionKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sessionKey = sessionKey
+}
+
+func (l *LastFMScrobbler) Name() string { return "lastfm" }
+
+const lastFMAPIURL = "https://ws.audioscrobbler.com/2.0/"
+
+func (l *LastFMScrobbler) NowPlaying(ctx context.Context, track *earbugv4.Track) error {
+	v := url.Values{
+		"method": {"track.updateNowPlaying"},
+		"track":  {track.Name},
+		"artist": {artistName(track)},
+	}
+	return l.call(ctx, v)
+}
+
+func (l *LastFMScrobbler) Scrobble(ctx context.Context, startTime time.Time, track *earbugv4.Track) error {
+	v := url.Values{
+		"method":    {"track.scrobble"},
+		"track":     {track.Name},
+		"artist":    {artistName(track)},
+		"timestamp": {strconv.FormatInt(startTime.Unix(), 10)},
+	}
+	return l.call(ctx, v)
+}
+
+func (l *LastFMScrobbler) call(ctx context.Context, v url.Values) error {
+	l.mu.RLock()
+	sessionKey := l.sessionKey
+	l.mu.RUnlock()
+
+	v.Set("api_key", l.apiKey)
+	v.Set("sk", sessionKey)
+	v.Set("api_sig", l.sign(v))
+	v.Set("format", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, lastFMAPIURL, nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.URL.RawQuery = v.Encode()
+	res, err := l.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("last.fm: unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// sign implements Last.fm's method signature: every param except format and
+// callback, sorted by key, concatenated as key+value, suffixed with the
+// shared secret, then md5'd.
+func (l *LastFMScrobbler) sign(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		if k == "format" || k == "callback" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := md5.New()
+	for _, k := range keys {
+		fmt.Fprint(h, k, v.Get(k))
+	}
+	fmt.Fprint(h, l.apiSecret)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LastFMGetSession exchanges a token granted via last.fm's auth URL for a
+// session key that never expires, per last.fm's "desktop" auth flow.
+func LastFMGetSession(ctx context.Context, apiKey, apiSecret, token string) (string, error) {
+	var out struct {
+		Session struct {
+			Key string `json:"key"`
+		} `json:"session"`
+	}
+	v := url.Values{
+		"method":  {"auth.getSession"},
+		"api_key": {apiKey},
+		"token":   {token},
+		"format":  {"json"},
+	}
+	v.Set("api_sig", lastFMSignValues(v, apiSecret))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lastFMAPIURL+"?"+v.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("new request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("last.fm: unexpected status %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	return out.Session.Key, nil
+}
+
+// lastFMSignValues implements last.fm's method signature, the free
+// function form used outside of an already-authorized LastFMScrobbler.
+func lastFMSignValues(v url.Values, apiSecret string) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		if k == "format" || k == "callback" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := md5.New()
+	for _, k := range keys {
+		fmt.Fprint(h, k, v.Get(k))
+	}
+	fmt.Fprint(h, apiSecret)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ListenBrainzScrobbler submits listens to ListenBrainz using a user token.
+// The token can arrive later, via /api/auth/listenbrainz, so it's guarded
+// by a mutex rather than fixed at construction.
+type ListenBrainzScrobbler struct {
+	http *http.Client
+
+	mu        sync.RWMutex
+	userToken string
+}
+
+func NewListenBrainzScrobbler(httpClient *http.Client, userToken string) *ListenBrainzScrobbler {
+	return &ListenBrainzScrobbler{http: httpClient, userToken: userToken}
+}
+
+// SetUserToken updates the token used for subsequent calls, once the user
+// has pasted in a freshly generated ListenBrainz user token.
+func (lb *ListenBrainzScrobbler) SetUserToken(userToken string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.userToken = userToken
+}
+
+func (lb *ListenBrainzScrobbler) Name() string { return "listenbrainz" }
+
+const listenBrainzSubmitURL = "https://api.listenbrainz.org/1/submit-listens"
+
+type listenBrainzSubmission struct {
+	ListenType string             `json:"listen_type"`
+	Payload    []listenBrainzItem `json:"payload"`
+}
+
+type listenBrainzItem struct {
+	ListenedAt    int64                     `json:"listened_at,omitempty"`
+	TrackMetadata listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string                     `json:"artist_name"`
+	TrackName      string                     `json:"track_name"`
+	AdditionalInfo listenBrainzAdditionalInfo `json:"additional_info"`
+}
+
+type listenBrainzAdditionalInfo struct {
+	SpotifyID string `json:"spotify_id,omitempty"`
+}
+
+func (lb *ListenBrainzScrobbler) NowPlaying(ctx context.Context, track *earbugv4.Track) error {
+	return lb.submit(ctx, "playing_now", listenBrainzItem{
+		TrackMetadata: trackMetadata(track),
+	})
+}
+
+func (lb *ListenBrainzScrobbler) Scrobble(ctx context.Context, startTime time.Time, track *earbugv4.Track) error {
+	return lb.submit(ctx, "single", listenBrainzItem{
+		ListenedAt:    startTime.Unix(),
+		TrackMetadata: trackMetadata(track),
+	})
+}
+
+func (lb *ListenBrainzScrobbler) submit(ctx context.Context, listenType string, item listenBrainzItem) error {
+	b, err := json.Marshal(listenBrainzSubmission{ListenType: listenType, Payload: []listenBrainzItem{item}})
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, listenBrainzSubmitURL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	lb.mu.RLock()
+	userToken := lb.userToken
+	lb.mu.RUnlock()
+
+	req.Header.Set("Authorization", "Token "+userToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := lb.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("listenbrainz: unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+func trackMetadata(track *earbugv4.Track) listenBrainzTrackMetadata {
+	return listenBrainzTrackMetadata{
+		ArtistName:     artistName(track),
+		TrackName:      track.Name,
+		AdditionalInfo: listenBrainzAdditionalInfo{SpotifyID: track.Id},
+	}
+}
+
+func artistName(track *earbugv4.Track) string {
+	if len(track.Artists) == 0 {
+		return ""
+	}
+	return track.Artists[0].Name
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/zmb3/spotify/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// spotifyTokenURL is Spotify's token endpoint, used directly with
+// clientcredentials.Config rather than through spotifyauth (which is
+// built around the user authorization-code flow the rest of this package
+// uses, not client-credentials).
+const spotifyTokenURL = "https://accounts.spotify.com/api/token"
+
+// newClientCredentialsClient builds a *spotify.Client authorized via the
+// client-credentials grant (app-only, no user token), so batch lookups of
+// public catalog data like album/genre/audio-feature metadata don't burn
+// any individual user's rate limit.
+func newClientCredentialsClient(ctx context.Context, spotifyID, spotifySecret string) *spotify.Client {
+	cfg := &clientcredentials.Config{
+		ClientID:     spotifyID,
+		ClientSecret: spotifySecret,
+		TokenURL:     spotifyTokenURL,
+	}
+	authCtx := context.WithValue(ctx, oauth2.HTTPClient, &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	})
+	httpClient := cfg.Client(authCtx)
+	httpClient.Transport = otelhttp.NewTransport(httpClient.Transport)
+	return spotify.New(httpClient, spotify.WithRetry(true))
+}
+
+// trackAlbum, trackAudioFeatures and trackEnrichment mirror the fields the
+// request asks to add to earbugv3.Track. That proto is generated outside
+// this repo with no .proto source here to extend, so enrichment is kept as
+// a sidecar JSON object per user, keyed by track id, the same workaround
+// used for the ListenBrainz linkage in listenbrainz.go.
+type trackAlbum struct {
+	ID          string   `json:"id,omitempty"`
+	URI         string   `json:"uri,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	ReleaseDate string   `json:"release_date,omitempty"`
+	Images      []string `json:"images,omitempty"`
+}
+
+type trackAudioFeatures struct {
+	Danceability float64 `json:"danceability"`
+	Energy       float64 `json:"energy"`
+	Tempo        float64 `json:"tempo"`
+	Valence      float64 `json:"valence"`
+}
+
+type trackEnrichment struct {
+	Album         trackAlbum         `json:"album"`
+	Genres        []string           `json:"genres,omitempty"`
+	Popularity    int                `json:"popularity"`
+	AudioFeatures trackAudioFeatures `json:"audio_features"`
+	EnrichedAt    time.Time          `json:"enriched_at"`
+}
+
+func enrichmentObject(bkt *storage.BucketHandle, user string) *storage.ObjectHandle {
+	return bkt.Object(user + ".enrichment.json")
+}
+
+// readEnrichment returns an empty map, not an error, if nothing's been
+// enriched for user yet.
+func readEnrichment(ctx context.Context, bkt *storage.BucketHandle, user string) (map[string]trackEnrichment, error) {
+	or, err := enrichmentObject(bkt, user).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return map[string]trackEnrichment{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read enrichment: %w", err)
+	}
+	defer or.Close()
+
+	enrichment := map[string]trackEnrichment{}
+	if err := json.NewDecoder(or).Decode(&enrichment); err != nil {
+		return nil, fmt.Errorf("decode enrichment: %w", err)
+	}
+	return enrichment, nil
+}
+
+func writeEnrichment(ctx context.Context, bkt *storage.BucketHandle, user string, enrichment map[string]trackEnrichment) error {
+	ow := enrichmentObject(bkt, user).NewWriter(ctx)
+	if err := json.NewEncoder(ow).Encode(enrichment); err != nil {
+		ow.Close()
+		return fmt.Errorf("encode enrichment: %w", err)
+	}
+	if err := ow.Close(); err != nil {
+		return fmt.Errorf("write enrichment: %w", err)
+	}
+	return nil
+}
+
+// enrichTracks fetches album, genre and audio-feature metadata for every
+// id in trackIDs that isn't already enriched, merges the result into the
+// user's sidecar object and returns the updated map. Lookups are batched
+// at Spotify's own per-endpoint limits: 50 ids for GetTracks and
+// GetArtists, 100 for GetAudioFeatures.
+func enrichTracks(ctx context.Context, cc *spotify.Client, bkt *storage.BucketHandle, user string, trackIDs []string) (map[string]trackEnrichment, error) {
+	ctx, span := otel.Tracer("earbug-userdata").Start(ctx, "enrich-tracks")
+	defer span.End()
+
+	enrichment, err := readEnrichment(ctx, bkt, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, id := range trackIDs {
+		if e, ok := enrichment[id]; !ok || e.EnrichedAt.IsZero() {
+			pending = append(pending, id)
+		}
+	}
+	if len(pending) == 0 {
+		return enrichment, nil
+	}
+
+	trackArtists := map[string][]string{}
+	for _, batch := range chunkStrings(pending, 50) {
+		tracks, err := cc.GetTracks(ctx, toSpotifyIDs(batch))
+		if err != nil {
+			return nil, fmt.Errorf("get tracks: %w", err)
+		}
+		for _, t := range tracks {
+			if t == nil {
+				continue
+			}
+			id := t.ID.String()
+			e := enrichment[id]
+			e.Popularity = int(t.Popularity)
+			e.Album = trackAlbum{
+				ID:          t.Album.ID.String(),
+				URI:         string(t.Album.URI),
+				Name:        t.Album.Name,
+				ReleaseDate: t.Album.ReleaseDate,
+			}
+			for _, img := range t.Album.Images {
+				e.Album.Images = append(e.Album.Images, img.URL)
+			}
+			enrichment[id] = e
+
+			for _, artist := range t.Artists {
+				trackArtists[id] = append(trackArtists[id], artist.ID.String())
+			}
+		}
+	}
+
+	artistIDSet := map[string]bool{}
+	for _, artists := range trackArtists {
+		for _, id := range artists {
+			artistIDSet[id] = true
+		}
+	}
+	var artistIDs []string
+	for id := range artistIDSet {
+		artistIDs = append(artistIDs, id)
+	}
+
+	// A track's Genres is the union of its own artists' genres, since
+	// earbugv3.Track carries no artist-level enrichment of its own.
+	artistGenres := map[string][]string{}
+	for _, batch := range chunkStrings(artistIDs, 50) {
+		artists, err := cc.GetArtists(ctx, toSpotifyIDs(batch)...)
+		if err != nil {
+			return nil, fmt.Errorf("get artists: %w", err)
+		}
+		for _, a := range artists {
+			if a == nil {
+				continue
+			}
+			artistGenres[a.ID.String()] = a.Genres
+		}
+	}
+	for trackID, artists := range trackArtists {
+		seen := map[string]bool{}
+		var genres []string
+		for _, aid := range artists {
+			for _, g := range artistGenres[aid] {
+				if !seen[g] {
+					seen[g] = true
+					genres = append(genres, g)
+				}
+			}
+		}
+		e := enrichment[trackID]
+		e.Genres = genres
+		enrichment[trackID] = e
+	}
+
+	for _, batch := range chunkStrings(pending, 100) {
+		features, err := cc.GetAudioFeatures(ctx, toSpotifyIDs(batch)...)
+		if err != nil {
+			return nil, fmt.Errorf("get audio features: %w", err)
+		}
+		for _, f := range features {
+			if f == nil {
+				continue
+			}
+			id := f.ID.String()
+			e := enrichment[id]
+			e.AudioFeatures = trackAudioFeatures{
+				Danceability: float64(f.Danceability),
+				Energy:       float64(f.Energy),
+				Tempo:        float64(f.Tempo),
+				Valence:      float64(f.Valence),
+			}
+			enrichment[id] = e
+		}
+	}
+
+	now := time.Now()
+	for _, id := range pending {
+		e := enrichment[id]
+		e.EnrichedAt = now
+		enrichment[id] = e
+	}
+
+	if err := writeEnrichment(ctx, bkt, user, enrichment); err != nil {
+		return nil, err
+	}
+	return enrichment, nil
+}
+
+func chunkStrings(ids []string, size int) [][]string {
+	var chunks [][]string
+	for len(ids) > 0 {
+		n := size
+		if n > len(ids) {
+			n = len(ids)
+		}
+		chunks = append(chunks, ids[:n])
+		ids = ids[n:]
+	}
+	return chunks
+}
+
+func toSpotifyIDs(ids []string) []spotify.ID {
+	out := make([]spotify.ID, len(ids))
+	for i, id := range ids {
+		out[i] = spotify.ID(id)
+	}
+	return out
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	earbugv3 "go.seankhliao.com/earbug/v3/pb/earbug/v3"
+)
+
+// importEntry mirrors one line of a Spotify "Extended streaming history"
+// GDPR export: older exports use endTime (minute precision, "2006-01-02
+// 15:04", implicitly UTC), newer ones use ts (RFC3339).
+type importEntry struct {
+	EndTime         string `json:"endTime"`
+	Ts              string `json:"ts"`
+	MsPlayed        int64  `json:"msPlayed"`
+	SpotifyTrackURI string `json:"spotifyTrackUri"`
+	ArtistName      string `json:"artistName"`
+	TrackName       string `json:"trackName"`
+	AlbumName       string `json:"albumName"`
+}
+
+const importMinMsPlayed = 30_000 // spotify's own scrobble threshold
+
+// importEntryTime parses whichever of ts/endTime an entry carries.
+func importEntryTime(e importEntry) (time.Time, bool) {
+	if e.Ts != "" {
+		if t, err := time.Parse(time.RFC3339, e.Ts); err == nil {
+			return t, true
+		}
+	}
+	if e.EndTime != "" {
+		if t, err := time.Parse("2006-01-02 15:04", e.EndTime); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// trackIDFromURI pulls the id off the end of a "spotify:track:<id>" uri.
+func trackIDFromURI(uri string) string {
+	_, id, ok := strings.Cut(uri, "spotify:track:")
+	if !ok {
+		return uri
+	}
+	return id
+}
+
+type importReq struct {
+	User    string        `json:"user"`
+	Entries []importEntry `json:"entries"`
+}
+
+type importResp struct {
+	Imported int `json:"imported"`
+	Deduped  int `json:"deduped"`
+	Skipped  int `json:"skipped"`
+}
+
+// importHistory ingests one chunk of a GDPR export — this package's
+// JSON-POST stand-in for a Connect RPC ImportHistory(stream ImportChunk);
+// see the package doc comment for why. Streaming client->server chunks is
+// exactly what repeated JSON POST calls already give for free, so the
+// client (the import subcommand) sends one chunk per request instead of
+// opening a single long-lived RPC stream; that keeps a multi-GB export
+// from ever needing to sit in memory in full on either side.
+func (s *Server) importHistory(rw http.ResponseWriter, r *http.Request) {
+	log := s.log.WithName("import")
+	ctx, span := s.trace.Start(r.Context(), "import")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		http.Error(rw, "POST only", http.StatusBadRequest)
+		return
+	}
+
+	var req importReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(rw, "decode request", http.StatusBadRequest)
+		log.Error(err, "decode request", "ctx", ctx, "http_request", r)
+		return
+	}
+	if req.User == "" {
+		http.Error(rw, "no user provided", http.StatusBadRequest)
+		return
+	}
+	log = log.WithValues("user", req.User)
+
+	var resp importResp
+	for ok, ctr := false, 0; !ok; ctr++ {
+		log.V(1).Info("importing chunk", "attempt", ctr, "ctx", ctx)
+		var respi any
+		var err error
+		respi, err, _ = s.single.Do(req.User, func() (any, error) {
+			u, err := newUserData(ctx, s.bkt, req.User, r.Host, s.spotifyID, s.spotifySecret, nil, s.log, s.listenbrainzEnabled, s.lbClient, s.enrichEnabled, s.ccClient)
+			if err != nil {
+				return nil, err
+			}
+
+			var stats importResp
+			var newTrackIDs []string
+			for _, e := range req.Entries {
+				if e.MsPlayed < importMinMsPlayed {
+					stats.Skipped++
+					continue
+				}
+				t, ok := importEntryTime(e)
+				if !ok {
+					stats.Skipped++
+					continue
+				}
+
+				ts := t.Format(time.RFC3339Nano)
+				if _, ok := u.data.Playbacks[ts]; ok {
+					stats.Deduped++
+					continue
+				}
+
+				trackID := trackIDFromURI(e.SpotifyTrackURI)
+				if _, ok := u.data.Tracks[trackID]; !ok {
+					// Built from the export entry alone, so it has no
+					// Duration or Artists; enrichTracks below only
+					// writes sidecar album/genre/audio-feature
+					// metadata and doesn't fill those fields in.
+					u.data.Tracks[trackID] = &earbugv3.Track{
+						Id:   trackID,
+						Uri:  e.SpotifyTrackURI,
+						Name: e.TrackName,
+					}
+					newTrackIDs = append(newTrackIDs, trackID)
+				}
+
+				u.data.Playbacks[ts] = &earbugv3.Playback{
+					TrackId:  trackID,
+					TrackUri: e.SpotifyTrackURI,
+				}
+				stats.Imported++
+			}
+
+			if u.enrichEnabled && len(newTrackIDs) > 0 {
+				if _, err := enrichTracks(ctx, u.ccClient, u.bkt, u.user, newTrackIDs); err != nil {
+					u.log.Error(err, "enrich imported tracks", "ctx", ctx)
+				}
+			}
+
+			if err := u.write(ctx); err != nil {
+				return nil, err
+			}
+			return stats, nil
+		})
+		if err != nil {
+			http.Error(rw, "import chunk", http.StatusInternalServerError)
+			log.Error(err, "import chunk", "ctx", ctx, "http_request", r)
+			return
+		}
+		resp, ok = respi.(importResp)
+	}
+
+	json.NewEncoder(rw).Encode(resp)
+	log.Info("imported chunk", "imported", resp.Imported, "deduped", resp.Deduped, "skipped", resp.Skipped, "ctx", ctx, "http_request", r)
+}
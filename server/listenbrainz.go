@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/zmb3/spotify/v2"
+	earbugv3 "go.seankhliao.com/earbug/v3/pb/earbug/v3"
+)
+
+// listenBrainzConfig is a user's ListenBrainz linkage: the user token they
+// generate from their ListenBrainz profile, and the time up to which their
+// history has been scrobbled. earbugv3.Store has no spare field for this
+// (and no .proto source here to add one to), so it's kept as a small
+// sidecar JSON object next to the user's earbugv3.Store blob rather than
+// on the proto message itself.
+type listenBrainzConfig struct {
+	UserToken       string    `json:"user_token"`
+	LastScrobbledAt time.Time `json:"last_scrobbled_at"`
+}
+
+func listenBrainzObject(bkt *storage.BucketHandle, user string) *storage.ObjectHandle {
+	return bkt.Object(user + ".listenbrainz.json")
+}
+
+// readListenBrainzConfig returns the zero value, not an error, if the user
+// has never linked a ListenBrainz account.
+func readListenBrainzConfig(ctx context.Context, bkt *storage.BucketHandle, user string) (listenBrainzConfig, error) {
+	or, err := listenBrainzObject(bkt, user).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return listenBrainzConfig{}, nil
+	} else if err != nil {
+		return listenBrainzConfig{}, fmt.Errorf("read listenbrainz config: %w", err)
+	}
+	defer or.Close()
+
+	var cfg listenBrainzConfig
+	if err := json.NewDecoder(or).Decode(&cfg); err != nil {
+		return listenBrainzConfig{}, fmt.Errorf("decode listenbrainz config: %w", err)
+	}
+	return cfg, nil
+}
+
+func writeListenBrainzConfig(ctx context.Context, bkt *storage.BucketHandle, user string, cfg listenBrainzConfig) error {
+	ow := listenBrainzObject(bkt, user).NewWriter(ctx)
+	if err := json.NewEncoder(ow).Encode(cfg); err != nil {
+		ow.Close()
+		return fmt.Errorf("encode listenbrainz config: %w", err)
+	}
+	if err := ow.Close(); err != nil {
+		return fmt.Errorf("write listenbrainz config: %w", err)
+	}
+	return nil
+}
+
+const listenBrainzSubmitURL = "https://api.listenbrainz.org/1/submit-listens"
+
+// listenBrainzMaxRetries bounds the backoff loop in listenBrainzClient.submit
+// so a persistently unavailable ListenBrainz doesn't block an update
+// indefinitely; anything still queued after that is picked up by the next
+// /update or /listenbrainz/backfill call.
+const listenBrainzMaxRetries = 3
+
+// errListenBrainzUnauthorized signals a rejected user token, distinct from
+// a transient failure, so the caller knows to clear it rather than retry.
+var errListenBrainzUnauthorized = errors.New("listenbrainz: invalid user token")
+
+type listenBrainzSubmission struct {
+	ListenType string             `json:"listen_type"`
+	Payload    []listenBrainzItem `json:"payload"`
+}
+
+type listenBrainzItem struct {
+	ListenedAt    int64                     `json:"listened_at,omitempty"`
+	TrackMetadata listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string                     `json:"artist_name"`
+	TrackName      string                     `json:"track_name"`
+	ReleaseName    string                     `json:"release_name,omitempty"`
+	AdditionalInfo listenBrainzAdditionalInfo `json:"additional_info"`
+}
+
+type listenBrainzAdditionalInfo struct {
+	SpotifyID  string `json:"spotify_id,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+// listenBrainzClient submits listens on behalf of all users, a user token
+// is passed per call rather than fixed at construction.
+type listenBrainzClient struct {
+	http *http.Client
+}
+
+// submit POSTs a batch of listens, retrying 429/5xx with backoff. A 401
+// is returned as errListenBrainzUnauthorized so the caller can clear the
+// stored token instead of retrying it forever.
+func (c *listenBrainzClient) submit(ctx context.Context, userToken, listenType string, items []listenBrainzItem) error {
+	b, err := json.Marshal(listenBrainzSubmission{ListenType: listenType, Payload: items})
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+
+	backoff := time.Second
+	var lastErr error
+	for attempt := 0; attempt <= listenBrainzMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, listenBrainzSubmitURL, bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("new request: %w", err)
+		}
+		req.Header.Set("Authorization", "Token "+userToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := c.http.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("do request: %w", err)
+			continue
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		switch {
+		case res.StatusCode == http.StatusOK:
+			return nil
+		case res.StatusCode == http.StatusUnauthorized:
+			return errListenBrainzUnauthorized
+		case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+			lastErr = fmt.Errorf("listenbrainz: unexpected status %s", res.Status)
+			continue
+		default:
+			return fmt.Errorf("listenbrainz: unexpected status %s", res.Status)
+		}
+	}
+	return lastErr
+}
+
+func spotifyArtistName(artists []spotify.SimpleArtist) string {
+	if len(artists) == 0 {
+		return ""
+	}
+	return artists[0].Name
+}
+
+func earbugv3ArtistName(artists []*earbugv3.Artist) string {
+	if len(artists) == 0 {
+		return ""
+	}
+	return artists[0].Name
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type generatePlaylistsReq struct {
+	User  string   `json:"user"`
+	Kinds []string `json:"kinds"`
+}
+
+// generatePlaylists runs the playlist Scheduler for a user, writing
+// curated playlists back to their Spotify account — this package's
+// JSON-POST stand-in for a Connect RPC GeneratePlaylists(request{Kinds
+// []string}); see the package doc comment for why, mirroring /update's
+// {"user": ...} request shape.
+func (s *Server) generatePlaylists(rw http.ResponseWriter, r *http.Request) {
+	log := s.log.WithName("generate-playlists")
+	ctx, span := s.trace.Start(r.Context(), "generate-playlists")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		http.Error(rw, "POST only", http.StatusBadRequest)
+		return
+	}
+
+	var req generatePlaylistsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(rw, "decode request", http.StatusBadRequest)
+		log.Error(err, "decode request", "ctx", ctx, "http_request", r)
+		return
+	}
+	if req.User == "" {
+		http.Error(rw, "no user provided", http.StatusBadRequest)
+		return
+	}
+	log = log.WithValues("user", req.User)
+
+	u, err := newUserData(ctx, s.bkt, req.User, r.Host, s.spotifyID, s.spotifySecret, nil, s.log, s.listenbrainzEnabled, s.lbClient, s.enrichEnabled, s.ccClient)
+	if err != nil {
+		http.Error(rw, "get user data", http.StatusInternalServerError)
+		log.Error(err, "get user data", "ctx", ctx, "http_request", r)
+		return
+	}
+
+	me, err := u.client.CurrentUser(ctx)
+	if err != nil {
+		http.Error(rw, "get spotify user", http.StatusInternalServerError)
+		log.Error(err, "get spotify user", "ctx", ctx, "http_request", r)
+		return
+	}
+
+	err = s.playlistScheduler.Run(ctx, u.client, me.ID, &u.data, time.Now(), req.Kinds)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("generate playlists: %v", err), http.StatusInternalServerError)
+		log.Error(err, "generate playlists", "ctx", ctx, "http_request", r)
+		return
+	}
+
+	rw.Write([]byte("ok"))
+	log.Info("playlists generated", "kinds", req.Kinds, "ctx", ctx, "http_request", r)
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	earbugv3 "go.seankhliao.com/earbug/v3/pb/earbug/v3"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// pollInterval is how often an already-tracked user's currently-playing
+// track is polled. /update's 50-item PlayerRecentlyPlayed window silently
+// drops plays for a user who listens to more than 50 tracks, or skips
+// frequently, between calls; polling currently-playing at this cadence
+// catches those in between, with /update left as the reconciliation pass
+// that backfills anything the poller missed (player outages, restarts)
+// with Spotify's own authoritative play timestamps.
+const pollInterval = 45 * time.Second
+
+// pollJitter staggers each user's first tick so a large user base doesn't
+// all poll Spotify in the same instant.
+const pollJitter = 30 * time.Second
+
+// Poller owns one ticking goroutine per user, polling PlayerCurrentlyPlaying
+// and recording a play once it's done (is_playing goes false, or
+// progress_ms resets while the track id is unchanged, meaning a replay).
+// The zmb3/spotify client is already constructed with spotify.WithRetry(true)
+// (see newUserData), which backs off on 429 honoring Spotify's Retry-After
+// itself, so Poller doesn't need to parse that header again.
+type Poller struct {
+	s *Server
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func newPoller(s *Server) *Poller {
+	return &Poller{s: s, cancels: make(map[string]context.CancelFunc)}
+}
+
+// Start discovers existing users from the bucket's "<user>.pb.zstd"
+// objects and begins polling each one. It returns once every known user
+// has a poll goroutine running; those goroutines run until ctx is done.
+func (p *Poller) Start(ctx context.Context) error {
+	it := p.s.bkt.Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("list users: %w", err)
+		}
+		user, ok := strings.CutSuffix(attrs.Name, ".pb.zstd")
+		if !ok {
+			continue
+		}
+		p.EnsureUser(ctx, user)
+	}
+}
+
+// EnsureUser starts a poll goroutine for user if one isn't already
+// running, e.g. right after they complete the Spotify auth flow.
+func (p *Poller) EnsureUser(ctx context.Context, user string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.cancels[user]; ok {
+		return
+	}
+	pctx, cancel := context.WithCancel(ctx)
+	p.cancels[user] = cancel
+	go p.pollUser(pctx, user)
+}
+
+// trackedPlay is the poller's in-memory view of a user's in-progress
+// play; nothing here is durable; a crash just means at most one play is
+// lost in between, the same gap /update's reconciliation pass covers.
+type trackedPlay struct {
+	trackID      string
+	track        *spotify.FullTrack
+	startedAt    time.Time
+	lastProgress time.Duration
+	playing      bool
+	confirmed    bool
+}
+
+func (p *Poller) pollUser(ctx context.Context, user string) {
+	log := p.s.log.WithName("poller").WithValues("user", user)
+
+	t := time.NewTimer(time.Duration(rand.Int63n(int64(pollJitter))))
+	defer t.Stop()
+
+	var tracking trackedPlay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		t.Reset(pollInterval)
+
+		if err := p.poll(ctx, user, &tracking); err != nil {
+			log.Error(err, "poll currently playing", "ctx", ctx)
+		}
+	}
+}
+
+func (p *Poller) poll(ctx context.Context, user string, tracking *trackedPlay) error {
+	// host is only used to build the OAuth redirect URL for the
+	// authorization-code exchange; refreshing an already-stored token
+	// (the only thing the poller ever does) never follows that redirect,
+	// so it's left blank here.
+	u, err := newUserData(ctx, p.s.bkt, user, "", p.s.spotifyID, p.s.spotifySecret, nil, p.s.log, p.s.listenbrainzEnabled, p.s.lbClient, p.s.enrichEnabled, p.s.ccClient)
+	if err != nil {
+		return fmt.Errorf("get user data: %w", err)
+	}
+
+	cur, err := u.client.PlayerCurrentlyPlaying(ctx)
+	if err != nil {
+		return fmt.Errorf("get currently playing: %w", err)
+	}
+	if cur == nil || cur.Item == nil {
+		if tracking.trackID != "" && !tracking.confirmed {
+			if err := p.confirm(ctx, user, *tracking); err != nil {
+				return err
+			}
+		}
+		*tracking = trackedPlay{}
+		return nil
+	}
+
+	trackID := cur.Item.ID.String()
+	progress := time.Duration(cur.Progress) * time.Millisecond
+
+	switch {
+	case tracking.trackID != trackID, progress < tracking.lastProgress && tracking.playing:
+		if tracking.trackID != "" && !tracking.confirmed {
+			if err := p.confirm(ctx, user, *tracking); err != nil {
+				return err
+			}
+		}
+		*tracking = trackedPlay{
+			trackID:      trackID,
+			track:        cur.Item,
+			startedAt:    time.Now().Add(-progress),
+			lastProgress: progress,
+			playing:      cur.Playing,
+		}
+	default:
+		if tracking.playing && !cur.Playing && !tracking.confirmed {
+			if err := p.confirm(ctx, user, *tracking); err != nil {
+				return err
+			}
+			tracking.confirmed = true
+		}
+		tracking.playing = cur.Playing
+		tracking.lastProgress = progress
+	}
+
+	return nil
+}
+
+// confirm records a finished play, deduping by started_at alone
+// against whatever /update's PlayerRecentlyPlayed backfill already wrote,
+// the same way /update dedupes against itself: a map key of the play's
+// start time. The poller's startedAt is only an estimate (now minus
+// observed progress_ms, not Spotify's own play-start timestamp), so a
+// later reconciliation by /update may still add a second, more precisely
+// timestamped entry for the same play; that's an accepted gap, not a
+// silent one, left for a future tightening of the key.
+func (p *Poller) confirm(ctx context.Context, user string, tr trackedPlay) error {
+	_, err, _ := p.s.single.Do(user, func() (any, error) {
+		u, err := newUserData(ctx, p.s.bkt, user, "", p.s.spotifyID, p.s.spotifySecret, nil, p.s.log, p.s.listenbrainzEnabled, p.s.lbClient, p.s.enrichEnabled, p.s.ccClient)
+		if err != nil {
+			return nil, fmt.Errorf("get user data: %w", err)
+		}
+
+		ts := tr.startedAt.Format(time.RFC3339Nano)
+		if _, ok := u.data.Playbacks[ts]; ok {
+			return nil, nil
+		}
+		u.data.Playbacks[ts] = &earbugv3.Playback{TrackId: tr.trackID}
+
+		// Populate the track's metadata from what poll() already fetched,
+		// same as userData.update does for its PlayerRecentlyPlayed items,
+		// so a poller-confirmed play has a name/artists to render by
+		// immediately instead of waiting on the next /update reconciliation.
+		if _, ok := u.data.Tracks[tr.trackID]; !ok && tr.track != nil {
+			t := &earbugv3.Track{
+				Id:       tr.trackID,
+				Uri:      string(tr.track.URI),
+				Type:     tr.track.Type,
+				Name:     tr.track.Name,
+				Duration: durationpb.New(tr.track.TimeDuration()),
+			}
+			for _, artist := range tr.track.Artists {
+				t.Artists = append(t.Artists, &earbugv3.Artist{
+					Id:   artist.ID.String(),
+					Uri:  string(artist.URI),
+					Name: artist.Name,
+				})
+			}
+			u.data.Tracks[tr.trackID] = t
+		}
+
+		if err := u.write(ctx); err != nil {
+			return nil, fmt.Errorf("write user data: %w", err)
+		}
+		return nil, nil
+	})
+	return err
+}
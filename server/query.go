@@ -0,0 +1,450 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	earbugv3 "go.seankhliao.com/earbug/v3/pb/earbug/v3"
+)
+
+// loadQueryUser is the shared shape of every query endpoint below:
+// decode a user-scoped JSON request body, then load that user's data.
+// req must be a pointer to the request struct, and user a pointer to its
+// User field, so the empty-user check works across the different request
+// types without repeating it at each call site.
+func (s *Server) loadQueryUser(rw http.ResponseWriter, r *http.Request, log logr.Logger, ctx context.Context, req any, user *string) (*userData, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "POST only", http.StatusBadRequest)
+		return nil, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(rw, "decode request", http.StatusBadRequest)
+		log.Error(err, "decode request", "ctx", ctx, "http_request", r)
+		return nil, false
+	}
+	if *user == "" {
+		http.Error(rw, "no user provided", http.StatusBadRequest)
+		return nil, false
+	}
+
+	u, err := newUserData(ctx, s.bkt, *user, r.Host, s.spotifyID, s.spotifySecret, nil, s.log, s.listenbrainzEnabled, s.lbClient, s.enrichEnabled, s.ccClient)
+	if err != nil {
+		http.Error(rw, "get user data", http.StatusInternalServerError)
+		log.Error(err, "get user data", "ctx", ctx, "http_request", r)
+		return nil, false
+	}
+	return u, true
+}
+
+// indexedPlayback is one playback as kept in a playbackIndex: just enough
+// to sort, range-query and attribute to an artist without re-walking
+// earbugv3.Store.Playbacks.
+type indexedPlayback struct {
+	playedAt time.Time
+	trackID  string
+}
+
+// playbackIndex is a queryable view over a single load of
+// earbugv3.Store: plays kept sorted oldest-first (for a binary-searched
+// time range) and bucketed by artist id, so ListPlaybacks/TopTracks/
+// TopArtists/ListeningTime don't each rescan the full playback map. Each
+// query handler builds it once per request from the u.data that
+// newUserData just read, rather than caching it across requests;
+// server.go's handlers already reconstruct a
+// fresh userData per request from the stored blob, so there's no
+// longer-lived cache to invalidate here either.
+type playbackIndex struct {
+	chrono   []indexedPlayback
+	byArtist map[string][]int // artist id -> ascending indices into chrono
+}
+
+func buildPlaybackIndex(store *earbugv3.Store) *playbackIndex {
+	idx := &playbackIndex{byArtist: map[string][]int{}}
+	for ts, p := range store.Playbacks {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			continue
+		}
+		idx.chrono = append(idx.chrono, indexedPlayback{playedAt: t, trackID: p.TrackId})
+	}
+	sort.Slice(idx.chrono, func(i, j int) bool { return idx.chrono[i].playedAt.Before(idx.chrono[j].playedAt) })
+
+	for i, ip := range idx.chrono {
+		track := store.Tracks[ip.trackID]
+		if track == nil {
+			continue
+		}
+		for _, artist := range track.Artists {
+			idx.byArtist[artist.Id] = append(idx.byArtist[artist.Id], i)
+		}
+	}
+	return idx
+}
+
+// rangeIndices returns the [lo, hi) bounds of idx.chrono covering
+// [from, to) via binary search on the time-sorted index.
+func (idx *playbackIndex) rangeIndices(from, to time.Time) (int, int) {
+	lo := sort.Search(len(idx.chrono), func(i int) bool { return !idx.chrono[i].playedAt.Before(from) })
+	hi := sort.Search(len(idx.chrono), func(i int) bool { return !idx.chrono[i].playedAt.Before(to) })
+	return lo, hi
+}
+
+// inRange reports whether chrono index i, already known to satisfy an
+// artist filter, falls within [lo, hi).
+func inRange(i, lo, hi int) bool { return i >= lo && i < hi }
+
+// matching returns chrono indices within [lo, hi), optionally restricted
+// to artistID, newest first.
+func (idx *playbackIndex) matching(lo, hi int, artistID string) []int {
+	var indices []int
+	if artistID == "" {
+		for i := hi - 1; i >= lo; i-- {
+			indices = append(indices, i)
+		}
+		return indices
+	}
+	byArtist := idx.byArtist[artistID]
+	for i := len(byArtist) - 1; i >= 0; i-- {
+		if inRange(byArtist[i], lo, hi) {
+			indices = append(indices, byArtist[i])
+		}
+	}
+	return indices
+}
+
+func windowOrDefault(from, to time.Time, def time.Duration) (time.Time, time.Time) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-def)
+	}
+	return from, to
+}
+
+func paginate[T any](items []T, offset, limit int) ([]T, int) {
+	total := len(items)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return items[offset:end], total
+}
+
+type listPlaybacksReq struct {
+	User     string    `json:"user"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	ArtistID string    `json:"artist_id"`
+	Offset   int       `json:"offset"`
+	Limit    int       `json:"limit"`
+}
+
+type playbackEntry struct {
+	PlayedAt time.Time `json:"played_at"`
+	TrackID  string    `json:"track_id"`
+	Track    string    `json:"track_name"`
+}
+
+type listPlaybacksResp struct {
+	Playbacks []playbackEntry `json:"playbacks"`
+	Total     int             `json:"total"`
+}
+
+// listPlaybacks is this package's JSON-POST stand-in for a Connect RPC
+// ListPlaybacks/TopTracks/TopArtists/ListeningTime; see the package doc
+// comment for why.
+func (s *Server) listPlaybacks(rw http.ResponseWriter, r *http.Request) {
+	log := s.log.WithName("list-playbacks")
+	ctx, span := s.trace.Start(r.Context(), "list-playbacks")
+	defer span.End()
+
+	var req listPlaybacksReq
+	u, ok := s.loadQueryUser(rw, r, log, ctx, &req, &req.User)
+	if !ok {
+		return
+	}
+
+	idx := buildPlaybackIndex(&u.data)
+	from, to := windowOrDefault(req.From, req.To, 7*24*time.Hour)
+	lo, hi := idx.rangeIndices(from, to)
+	indices := idx.matching(lo, hi, req.ArtistID)
+
+	entries := make([]playbackEntry, len(indices))
+	for i, ci := range indices {
+		ip := idx.chrono[ci]
+		name := ip.trackID
+		if t := u.data.Tracks[ip.trackID]; t != nil {
+			name = t.Name
+		}
+		entries[i] = playbackEntry{PlayedAt: ip.playedAt, TrackID: ip.trackID, Track: name}
+	}
+
+	page, total := paginate(entries, req.Offset, req.Limit)
+	json.NewEncoder(rw).Encode(listPlaybacksResp{Playbacks: page, Total: total})
+}
+
+type topCountsReq struct {
+	User     string    `json:"user"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	MinPlays int       `json:"min_plays"`
+	Offset   int       `json:"offset"`
+	Limit    int       `json:"limit"`
+}
+
+type countEntry struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Plays int    `json:"plays"`
+}
+
+type topCountsResp struct {
+	Entries []countEntry `json:"entries"`
+	Total   int          `json:"total"`
+}
+
+func rankedCounts(counts map[string]int, names map[string]string, minPlays int) []countEntry {
+	entries := make([]countEntry, 0, len(counts))
+	for id, n := range counts {
+		if n < minPlays {
+			continue
+		}
+		entries = append(entries, countEntry{ID: id, Name: names[id], Plays: n})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Plays != entries[j].Plays {
+			return entries[i].Plays > entries[j].Plays
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// topTracks is the workaround-equivalent of a Connect RPC TopTracks.
+func (s *Server) topTracks(rw http.ResponseWriter, r *http.Request) {
+	log := s.log.WithName("top-tracks")
+	ctx, span := s.trace.Start(r.Context(), "top-tracks")
+	defer span.End()
+
+	var req topCountsReq
+	u, ok := s.loadQueryUser(rw, r, log, ctx, &req, &req.User)
+	if !ok {
+		return
+	}
+
+	idx := buildPlaybackIndex(&u.data)
+	from, to := windowOrDefault(req.From, req.To, 7*24*time.Hour)
+	lo, hi := idx.rangeIndices(from, to)
+
+	counts := map[string]int{}
+	names := map[string]string{}
+	for _, ci := range idx.matching(lo, hi, "") {
+		trackID := idx.chrono[ci].trackID
+		counts[trackID]++
+		if t := u.data.Tracks[trackID]; t != nil {
+			names[trackID] = t.Name
+		}
+	}
+
+	entries := rankedCounts(counts, names, req.MinPlays)
+	page, total := paginate(entries, req.Offset, req.Limit)
+	json.NewEncoder(rw).Encode(topCountsResp{Entries: page, Total: total})
+}
+
+// topArtists is the workaround-equivalent of a Connect RPC TopArtists.
+func (s *Server) topArtists(rw http.ResponseWriter, r *http.Request) {
+	log := s.log.WithName("top-artists")
+	ctx, span := s.trace.Start(r.Context(), "top-artists")
+	defer span.End()
+
+	var req topCountsReq
+	u, ok := s.loadQueryUser(rw, r, log, ctx, &req, &req.User)
+	if !ok {
+		return
+	}
+
+	idx := buildPlaybackIndex(&u.data)
+	from, to := windowOrDefault(req.From, req.To, 7*24*time.Hour)
+	lo, hi := idx.rangeIndices(from, to)
+
+	counts := map[string]int{}
+	names := map[string]string{}
+	for artistID, artistIndices := range idx.byArtist {
+		for _, ci := range artistIndices {
+			if inRange(ci, lo, hi) {
+				counts[artistID]++
+			}
+		}
+	}
+	for _, track := range u.data.Tracks {
+		for _, artist := range track.Artists {
+			if _, ok := counts[artist.Id]; ok {
+				names[artist.Id] = artist.Name
+			}
+		}
+	}
+
+	entries := rankedCounts(counts, names, req.MinPlays)
+	page, total := paginate(entries, req.Offset, req.Limit)
+	json.NewEncoder(rw).Encode(topCountsResp{Entries: page, Total: total})
+}
+
+type listeningTimeReq struct {
+	User string    `json:"user"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type listeningTimeResp struct {
+	Plays         int           `json:"plays"`
+	ListeningTime time.Duration `json:"listening_time"`
+}
+
+// listeningTime is the workaround-equivalent of a Connect RPC
+// ListeningTime: total time listened within [from, to), summing each
+// played track's known duration and skipping plays of tracks whose
+// duration isn't stored.
+func (s *Server) listeningTime(rw http.ResponseWriter, r *http.Request) {
+	log := s.log.WithName("listening-time")
+	ctx, span := s.trace.Start(r.Context(), "listening-time")
+	defer span.End()
+
+	var req listeningTimeReq
+	u, ok := s.loadQueryUser(rw, r, log, ctx, &req, &req.User)
+	if !ok {
+		return
+	}
+
+	idx := buildPlaybackIndex(&u.data)
+	from, to := windowOrDefault(req.From, req.To, 7*24*time.Hour)
+	lo, hi := idx.rangeIndices(from, to)
+
+	var resp listeningTimeResp
+	for _, ci := range idx.matching(lo, hi, "") {
+		resp.Plays++
+		if t := u.data.Tracks[idx.chrono[ci].trackID]; t != nil {
+			resp.ListeningTime += t.Duration.AsDuration()
+		}
+	}
+	json.NewEncoder(rw).Encode(resp)
+}
+
+type statsData struct {
+	Window     string
+	TopTracks  []countEntry
+	TopArtists []countEntry
+}
+
+var statsTemplate = template.Must(template.New("stats").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!doctype html>
+<html>
+<head><title>earbug stats</title></head>
+<body>
+<h1>Top tracks ({{.Window}})</h1>
+<table border="1">
+<tr><th>rank</th><th>track</th><th>plays</th></tr>
+{{range $i, $e := .TopTracks}}<tr><td>{{inc $i}}</td><td>{{$e.Name}}</td><td>{{$e.Plays}}</td></tr>
+{{end}}
+</table>
+<h1>Top artists ({{.Window}})</h1>
+<table border="1">
+<tr><th>rank</th><th>artist</th><th>plays</th></tr>
+{{range $i, $e := .TopArtists}}<tr><td>{{inc $i}}</td><td>{{$e.Name}}</td><td>{{$e.Plays}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+// stats renders a browseable HTML view of a user's top tracks/artists
+// over a window, so this data doesn't need a separate frontend to read.
+func (s *Server) stats(rw http.ResponseWriter, r *http.Request) {
+	log := s.log.WithName("stats")
+	ctx, span := s.trace.Start(r.Context(), "stats")
+	defer span.End()
+
+	user := r.URL.Query().Get("user")
+	if user == "" {
+		http.Error(rw, "no user provided", http.StatusBadRequest)
+		return
+	}
+	log = log.WithValues("user", user)
+
+	window := 7 * 24 * time.Hour
+	if w := r.URL.Query().Get("window"); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil {
+			http.Error(rw, "invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	u, err := newUserData(ctx, s.bkt, user, r.Host, s.spotifyID, s.spotifySecret, nil, s.log, s.listenbrainzEnabled, s.lbClient, s.enrichEnabled, s.ccClient)
+	if err != nil {
+		http.Error(rw, "get user data", http.StatusInternalServerError)
+		log.Error(err, "get user data", "ctx", ctx, "http_request", r)
+		return
+	}
+
+	idx := buildPlaybackIndex(&u.data)
+	to := time.Now()
+	from := to.Add(-window)
+	lo, hi := idx.rangeIndices(from, to)
+
+	trackCounts := map[string]int{}
+	trackNames := map[string]string{}
+	for _, ci := range idx.matching(lo, hi, "") {
+		trackID := idx.chrono[ci].trackID
+		trackCounts[trackID]++
+		if t := u.data.Tracks[trackID]; t != nil {
+			trackNames[trackID] = t.Name
+		}
+	}
+	artistCounts := map[string]int{}
+	artistNames := map[string]string{}
+	for artistID, artistIndices := range idx.byArtist {
+		for _, ci := range artistIndices {
+			if inRange(ci, lo, hi) {
+				artistCounts[artistID]++
+			}
+		}
+	}
+	for _, track := range u.data.Tracks {
+		for _, artist := range track.Artists {
+			if _, ok := artistCounts[artist.Id]; ok {
+				artistNames[artist.Id] = artist.Name
+			}
+		}
+	}
+
+	data := statsData{
+		Window:     window.String(),
+		TopTracks:  rankedCounts(trackCounts, trackNames, 0),
+		TopArtists: rankedCounts(artistCounts, artistNames, 0),
+	}
+	if len(data.TopTracks) > 20 {
+		data.TopTracks = data.TopTracks[:20]
+	}
+	if len(data.TopArtists) > 20 {
+		data.TopArtists = data.TopArtists[:20]
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statsTemplate.Execute(rw, data); err != nil {
+		log.Error(err, "render stats", "ctx", ctx, "http_request", r)
+	}
+}
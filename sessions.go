@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"go.seankhliao.com/earbug/v4/sessions"
+	"go.seankhliao.com/webstyle"
+)
+
+// toSessionPlays adapts getPlaybacks's Playback rows into the shape the
+// shared sessions package groups, since Playback itself carries an
+// earbugv4.Track, not the plain id sessions.Play needs.
+func toSessionPlays(plays []Playback) []sessions.Play {
+	out := make([]sessions.Play, len(plays))
+	for i, p := range plays {
+		sp := sessions.Play{
+			StartTime:    p.StartTime,
+			PlaybackTime: p.PlaybackTime,
+			TrackID:      p.Track.Id,
+			ContextURI:   p.ContextURI,
+		}
+		for _, artist := range p.Track.Artists {
+			sp.ArtistIDs = append(sp.ArtistIDs, artist.Id)
+		}
+		out[i] = sp
+	}
+	return out
+}
+
+func (a *App) handleSessions(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := a.o.T.Start(r.Context(), "handleSessions")
+	defer span.End()
+
+	plays := a.getPlaybacks(ctx, optionsFromRequest(r))
+	sess := sessions.Compute(toSessionPlays(plays), a.sessionIdleGap)
+
+	var buf bytes.Buffer
+	buf.WriteString("### Sessions\n\n")
+	buf.WriteString("<table><thead><tr><th>start<th>end<th>listen time<th>plays<th>artists<th>tracks<th>context</tr></thead>\n<tbody>")
+	for _, s := range sess {
+		buf.WriteString("<tr><td>")
+		buf.WriteString(s.Start.String())
+		buf.WriteString("<td>")
+		buf.WriteString(s.End.String())
+		buf.WriteString("<td>")
+		buf.WriteString(s.ListenTime.String())
+		buf.WriteString("<td>")
+		buf.WriteString(strconv.Itoa(s.Plays))
+		buf.WriteString("<td>")
+		buf.WriteString(strconv.Itoa(s.DistinctArtists))
+		buf.WriteString("<td>")
+		buf.WriteString(strconv.Itoa(s.DistinctTracks))
+		buf.WriteString("<td>")
+		buf.WriteString(s.DominantContext)
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</tbody></table>")
+
+	err := a.render.Render(rw, &buf, webstyle.Data{})
+	if err != nil {
+		a.o.HTTPErr(ctx, "render", err, rw, http.StatusInternalServerError)
+		return
+	}
+}
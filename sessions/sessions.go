@@ -0,0 +1,104 @@
+// Package sessions groups a user's playbacks into listening sessions,
+// shared by main.go's and subcommands/serve's /sessions handlers so the
+// grouping logic isn't maintained twice; each caller adapts its own
+// store-backed Playback type into a Play before calling Compute.
+package sessions
+
+import "time"
+
+// Play is the minimal shape Compute needs from a playback.
+type Play struct {
+	StartTime    time.Time
+	PlaybackTime time.Duration
+	TrackID      string
+	ArtistIDs    []string
+	ContextURI   string
+}
+
+// Session is a run of plays with no gap larger than the configured idle
+// gap between them.
+type Session struct {
+	Start           time.Time
+	End             time.Time
+	ListenTime      time.Duration
+	Plays           int
+	DistinctArtists int
+	DistinctTracks  int
+	// DominantContext is the context (playlist/album) URI seen most often
+	// across the session's plays, empty if none of them carried one.
+	DominantContext string
+}
+
+// Compute groups plays (newest first, as getPlaybacks returns them) into
+// sessions separated by more than idleGap of inactivity. Sessions are
+// derived on the fly from the existing playbacks table rather than
+// persisted, since they're fully determined by it and idleGap is a
+// request-time parameter.
+func Compute(plays []Play, idleGap time.Duration) []Session {
+	if len(plays) == 0 {
+		return nil
+	}
+
+	chrono := make([]Play, len(plays))
+	for i, p := range plays {
+		chrono[len(plays)-1-i] = p
+	}
+
+	var sessions []Session
+	var cur *Session
+	artists := map[string]bool{}
+	tracks := map[string]bool{}
+	contexts := map[string]int{}
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.DistinctArtists = len(artists)
+		cur.DistinctTracks = len(tracks)
+		cur.DominantContext = dominantContext(contexts)
+		sessions = append(sessions, *cur)
+		cur = nil
+		artists = map[string]bool{}
+		tracks = map[string]bool{}
+		contexts = map[string]int{}
+	}
+
+	var prevEnd time.Time
+	for _, p := range chrono {
+		if cur != nil && p.StartTime.Sub(prevEnd) > idleGap {
+			flush()
+		}
+		if cur == nil {
+			cur = &Session{Start: p.StartTime}
+		}
+		cur.End = p.StartTime.Add(p.PlaybackTime)
+		cur.ListenTime += p.PlaybackTime
+		cur.Plays++
+		tracks[p.TrackID] = true
+		for _, artistID := range p.ArtistIDs {
+			artists[artistID] = true
+		}
+		if p.ContextURI != "" {
+			contexts[p.ContextURI]++
+		}
+		prevEnd = cur.End
+	}
+	flush()
+
+	for i, j := 0, len(sessions)-1; i < j; i, j = i+1, j-1 {
+		sessions[i], sessions[j] = sessions[j], sessions[i]
+	}
+	return sessions
+}
+
+func dominantContext(contexts map[string]int) string {
+	var best string
+	var bestN int
+	for uri, n := range contexts {
+		if n > bestN {
+			best, bestN = uri, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,481 @@
+// Package store provides a SQLite-backed replacement for the single-blob
+// zstd/protobuf Store, so reads and writes no longer require loading and
+// scanning the entire listening history in memory on every request.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"go.seankhliao.com/earbug/v4/scrobble"
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS tracks (
+		id TEXT PRIMARY KEY,
+		uri TEXT NOT NULL,
+		type TEXT NOT NULL,
+		name TEXT NOT NULL,
+		duration_ms INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS artists (
+		id TEXT PRIMARY KEY,
+		uri TEXT NOT NULL,
+		name TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS track_artists (
+		track_id TEXT NOT NULL REFERENCES tracks(id),
+		artist_id TEXT NOT NULL REFERENCES artists(id),
+		position INTEGER NOT NULL,
+		PRIMARY KEY (track_id, artist_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS playbacks (
+		source TEXT NOT NULL DEFAULT 'spotify',
+		start_time TEXT NOT NULL,
+		track_id TEXT NOT NULL REFERENCES tracks(id),
+		context_type TEXT NOT NULL,
+		context_uri TEXT NOT NULL,
+		PRIMARY KEY (source, start_time)
+	)`,
+	`CREATE TABLE IF NOT EXISTS pending_scrobbles (
+		scrobbler TEXT NOT NULL,
+		start_time TEXT NOT NULL,
+		track_id TEXT NOT NULL REFERENCES tracks(id),
+		PRIMARY KEY (scrobbler, start_time)
+	)`,
+	`CREATE INDEX IF NOT EXISTS playbacks_start_time ON playbacks (start_time)`,
+	`CREATE INDEX IF NOT EXISTS playbacks_track_id ON playbacks (track_id)`,
+	`CREATE INDEX IF NOT EXISTS track_artists_artist_id ON track_artists (artist_id)`,
+}
+
+// migrations holds ALTER TABLE statements for columns added after a
+// database may already have been created by an older version of schema.
+// Unlike schema, a "duplicate column" failure is expected and ignored.
+var migrations = []string{
+	`ALTER TABLE playbacks ADD COLUMN observed_duration_ms INTEGER NOT NULL DEFAULT 0`,
+}
+
+// Store is a SQLite-backed earbug listening history.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens (creating if necessary) the sqlite database at path and
+// ensures the schema is present.
+func Open(ctx context.Context, path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1) // modernc.org/sqlite: one writer at a time
+
+	s := &Store{db: db}
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("apply schema: %w", err)
+		}
+	}
+	for _, stmt := range migrations {
+		if _, err := db.ExecContext(ctx, stmt); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			return nil, fmt.Errorf("apply migration: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// PutTrack inserts a track and its artists if not already present.
+func (s *Store) PutTrack(ctx context.Context, t *earbugv4.Track) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO tracks (id, uri, type, name, duration_ms) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (id) DO NOTHING`,
+		t.Id, t.Uri, t.Type, t.Name, t.Duration.AsDuration().Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert track: %w", err)
+	}
+
+	for i, artist := range t.Artists {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO artists (id, uri, name) VALUES (?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+			artist.Id, artist.Uri, artist.Name,
+		)
+		if err != nil {
+			return fmt.Errorf("insert artist: %w", err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO track_artists (track_id, artist_id, position) VALUES (?, ?, ?)
+			 ON CONFLICT (track_id, artist_id) DO NOTHING`,
+			t.Id, artist.Id, i,
+		)
+		if err != nil {
+			return fmt.Errorf("link track artist: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Empty reports whether the store has no playbacks yet, so a caller can
+// gate a one-time import on it instead of repeating the import (and
+// whatever work fetching its source data took) on every restart.
+func (s *Store) Empty(ctx context.Context) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM playbacks LIMIT 1`).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("check playbacks: %w", err)
+	}
+	return n == 0, nil
+}
+
+// HasTrack reports whether a track id is already stored.
+func (s *Store) HasTrack(ctx context.Context, id string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM tracks WHERE id = ?`, id).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("check track: %w", err)
+	}
+	return n > 0, nil
+}
+
+// PutPlayback inserts a playback keyed by (source, RFC3339Nano start time),
+// reporting whether it was newly added. source identifies which agent
+// observed the play (e.g. "spotify", "listenbrainz"): one agent reporting
+// the same play again adds nothing, while the same moment reported by two
+// agents is stored once per agent.
+func (s *Store) PutPlayback(ctx context.Context, source string, startTime time.Time, p *earbugv4.Playback) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO playbacks (source, start_time, track_id, context_type, context_uri) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT (source, start_time) DO NOTHING`,
+		source, startTime.Format(time.RFC3339Nano), p.TrackId, p.ContextType, p.ContextUri,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert playback: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RecordProgress raises the observed playback duration for a play already
+// stored by PutPlayback, if observed is greater than what's already
+// recorded. It's fed by a currently-playing poller sampling progress_ms, so
+// a later, more complete sample never regresses an earlier one. For a play
+// PutPlayback hasn't stored yet it does nothing.
+func (s *Store) RecordProgress(ctx context.Context, source string, startTime time.Time, observed time.Duration) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE playbacks SET observed_duration_ms = MAX(observed_duration_ms, ?)
+		 WHERE source = ? AND start_time = ?`,
+		observed.Milliseconds(), source, startTime.Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return fmt.Errorf("record progress: %w", err)
+	}
+	return nil
+}
+
+// LastPlaybackTime returns the start time of the most recent playback
+// recorded for source, the per-agent watermark updateFromAgent passes back
+// as RecentlyPlayed's since so each update only asks an agent for plays it
+// hasn't already stored. The zero time, with ok false, means source has no
+// playbacks yet.
+func (s *Store) LastPlaybackTime(ctx context.Context, source string) (t time.Time, ok bool, err error) {
+	var ts sql.NullString
+	err = s.db.QueryRowContext(ctx,
+		`SELECT MAX(start_time) FROM playbacks WHERE source = ?`, source,
+	).Scan(&ts)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("query last playback time: %w", err)
+	}
+	if !ts.Valid {
+		return time.Time{}, false, nil
+	}
+	t, err = time.Parse(time.RFC3339Nano, ts.String)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("parse last playback time: %w", err)
+	}
+	return t, true, nil
+}
+
+// QueuePendingScrobble persists a scrobble that failed delivery to
+// scrobbler, so scrobble.Scrobblers.Retry can pick it up again even
+// across a process restart, rather than only tracking it in memory.
+func (s *Store) QueuePendingScrobble(ctx context.Context, scrobbler string, startTime time.Time, track *earbugv4.Track) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO pending_scrobbles (scrobbler, start_time, track_id) VALUES (?, ?, ?)
+		 ON CONFLICT (scrobbler, start_time) DO NOTHING`,
+		scrobbler, startTime.Format(time.RFC3339Nano), track.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("queue pending scrobble: %w", err)
+	}
+	return nil
+}
+
+// ListPendingScrobbles returns every scrobble still queued for scrobbler,
+// oldest first.
+func (s *Store) ListPendingScrobbles(ctx context.Context, scrobbler string) ([]scrobble.PendingScrobble, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT ps.start_time, t.id, t.uri, t.type, t.name, t.duration_ms
+		 FROM pending_scrobbles ps JOIN tracks t ON t.id = ps.track_id
+		 WHERE ps.scrobbler = ? ORDER BY ps.start_time`,
+		scrobbler,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query pending scrobbles: %w", err)
+	}
+	defer rows.Close()
+
+	var out []scrobble.PendingScrobble
+	for rows.Next() {
+		var ts string
+		var durationMs int64
+		track := &earbugv4.Track{}
+		if err := rows.Scan(&ts, &track.Id, &track.Uri, &track.Type, &track.Name, &durationMs); err != nil {
+			return nil, fmt.Errorf("scan pending scrobble: %w", err)
+		}
+		track.Duration = durationpb.New(time.Duration(durationMs) * time.Millisecond)
+
+		startTime, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return nil, fmt.Errorf("parse start time %s: %w", ts, err)
+		}
+
+		artists, err := s.trackArtists(ctx, track.Id)
+		if err != nil {
+			return nil, err
+		}
+		track.Artists = artists
+
+		out = append(out, scrobble.PendingScrobble{StartTime: startTime, Track: track})
+	}
+	return out, rows.Err()
+}
+
+// DeletePendingScrobble removes a scrobble from the retry queue, e.g. once
+// it's been delivered successfully.
+func (s *Store) DeletePendingScrobble(ctx context.Context, scrobbler string, startTime time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM pending_scrobbles WHERE scrobbler = ? AND start_time = ?`,
+		scrobbler, startTime.Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return fmt.Errorf("delete pending scrobble: %w", err)
+	}
+	return nil
+}
+
+// Options filters a playback listing (ListPlaybacks always returns it newest
+// first); it is pushed down into SQL rather than applied to rows scanned
+// into memory.
+type Options struct {
+	From time.Time
+	To   time.Time
+
+	Artist string
+	Track  string
+}
+
+// Playback is a single play joined with its track and artists.
+type Playback struct {
+	StartTime time.Time
+	Track     *earbugv4.Track
+
+	// ObservedDuration is the highest progress_ms sampled by a
+	// currently-playing poller while this play was active, if any. Zero
+	// means no sample was recorded and callers should fall back to a
+	// duration heuristic.
+	ObservedDuration time.Duration
+
+	ContextType string
+	ContextURI  string
+}
+
+// ListPlaybacks runs o as a single indexed query, newest first.
+func (s *Store) ListPlaybacks(ctx context.Context, o Options) ([]Playback, error) {
+	var where []string
+	var args []any
+
+	if !o.From.IsZero() {
+		where = append(where, "p.start_time >= ?")
+		args = append(args, o.From.Format(time.RFC3339Nano))
+	}
+	if !o.To.IsZero() {
+		where = append(where, "p.start_time <= ?")
+		args = append(args, o.To.Format(time.RFC3339Nano))
+	}
+	if o.Track != "" {
+		where = append(where, "t.name LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+likeEscape(o.Track)+"%")
+	}
+	if o.Artist != "" {
+		where = append(where, `p.track_id IN (
+			SELECT ta.track_id FROM track_artists ta
+			JOIN artists a ON a.id = ta.artist_id
+			WHERE a.name LIKE ? ESCAPE '\'
+		)`)
+		args = append(args, "%"+likeEscape(o.Artist)+"%")
+	}
+
+	q := `SELECT p.start_time, t.id, t.uri, t.type, t.name, t.duration_ms, p.observed_duration_ms, p.context_type, p.context_uri
+	      FROM playbacks p JOIN tracks t ON t.id = p.track_id`
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	q += " ORDER BY p.start_time DESC"
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query playbacks: %w", err)
+	}
+	defer rows.Close()
+
+	var plays []Playback
+	for rows.Next() {
+		var ts, contextType, contextURI string
+		var durationMs, observedMs int64
+		track := &earbugv4.Track{}
+		if err := rows.Scan(&ts, &track.Id, &track.Uri, &track.Type, &track.Name, &durationMs, &observedMs, &contextType, &contextURI); err != nil {
+			return nil, fmt.Errorf("scan playback: %w", err)
+		}
+		track.Duration = durationpb.New(time.Duration(durationMs) * time.Millisecond)
+
+		startTime, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return nil, fmt.Errorf("parse start time %s: %w", ts, err)
+		}
+
+		artists, err := s.trackArtists(ctx, track.Id)
+		if err != nil {
+			return nil, err
+		}
+		track.Artists = artists
+
+		plays = append(plays, Playback{
+			StartTime:        startTime,
+			Track:            track,
+			ObservedDuration: time.Duration(observedMs) * time.Millisecond,
+			ContextType:      contextType,
+			ContextURI:       contextURI,
+		})
+	}
+	return plays, rows.Err()
+}
+
+func (s *Store) trackArtists(ctx context.Context, trackID string) ([]*earbugv4.Artist, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT a.id, a.uri, a.name FROM track_artists ta
+		 JOIN artists a ON a.id = ta.artist_id
+		 WHERE ta.track_id = ? ORDER BY ta.position`,
+		trackID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query track artists: %w", err)
+	}
+	defer rows.Close()
+
+	var artists []*earbugv4.Artist
+	for rows.Next() {
+		a := &earbugv4.Artist{}
+		if err := rows.Scan(&a.Id, &a.Uri, &a.Name); err != nil {
+			return nil, fmt.Errorf("scan artist: %w", err)
+		}
+		artists = append(artists, a)
+	}
+	return artists, rows.Err()
+}
+
+func likeEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// Export serializes the full store back into the existing protobuf shape,
+// so the Export RPC keeps working unchanged for callers.
+func (s *Store) Export(ctx context.Context) (*earbugv4.Store, error) {
+	out := &earbugv4.Store{
+		Tracks:    make(map[string]*earbugv4.Track),
+		Playbacks: make(map[string]*earbugv4.Playback),
+	}
+
+	trackRows, err := s.db.QueryContext(ctx, `SELECT id, uri, type, name, duration_ms FROM tracks`)
+	if err != nil {
+		return nil, fmt.Errorf("query tracks: %w", err)
+	}
+	defer trackRows.Close()
+	for trackRows.Next() {
+		var durationMs int64
+		t := &earbugv4.Track{}
+		if err := trackRows.Scan(&t.Id, &t.Uri, &t.Type, &t.Name, &durationMs); err != nil {
+			return nil, fmt.Errorf("scan track: %w", err)
+		}
+		t.Duration = durationpb.New(time.Duration(durationMs) * time.Millisecond)
+		artists, err := s.trackArtists(ctx, t.Id)
+		if err != nil {
+			return nil, err
+		}
+		t.Artists = artists
+		out.Tracks[t.Id] = t
+	}
+	if err := trackRows.Err(); err != nil {
+		return nil, err
+	}
+
+	playRows, err := s.db.QueryContext(ctx, `SELECT start_time, track_id, context_type, context_uri FROM playbacks`)
+	if err != nil {
+		return nil, fmt.Errorf("query playbacks: %w", err)
+	}
+	defer playRows.Close()
+	for playRows.Next() {
+		var ts string
+		p := &earbugv4.Playback{}
+		if err := playRows.Scan(&ts, &p.TrackId, &p.ContextType, &p.ContextUri); err != nil {
+			return nil, fmt.Errorf("scan playback: %w", err)
+		}
+		if track := out.Tracks[p.TrackId]; track != nil {
+			p.TrackUri = track.Uri
+		}
+		out.Playbacks[ts] = p
+	}
+	return out, playRows.Err()
+}
+
+// Import seeds the store from an existing zstd proto blob, e.g. one
+// produced by the previous single-blob Export.
+func (s *Store) Import(ctx context.Context, in *earbugv4.Store) error {
+	for _, t := range in.Tracks {
+		if err := s.PutTrack(ctx, t); err != nil {
+			return fmt.Errorf("import track %s: %w", t.Id, err)
+		}
+	}
+	for ts, p := range in.Playbacks {
+		startTime, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			startTime, err = time.Parse(time.RFC3339, ts)
+			if err != nil {
+				return fmt.Errorf("parse playback time %s: %w", ts, err)
+			}
+		}
+		if _, err := s.PutPlayback(ctx, "spotify", startTime, p); err != nil {
+			return fmt.Errorf("import playback %s: %w", ts, err)
+		}
+	}
+	return nil
+}
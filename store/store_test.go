@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	ctx := context.Background()
+	s, err := Open(ctx, filepath.Join(t.TempDir(), "earbug.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestLikeEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{`100% done`, `100\% done`},
+		{"a_b", `a\_b`},
+		{`back\slash`, `back\\slash`},
+	}
+	for _, tt := range tests {
+		if got := likeEscape(tt.in); got != tt.want {
+			t.Errorf("likeEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestOpenMigrationsIdempotent confirms Open tolerates being called twice
+// against the same database, so a restart doesn't fail on migrations'
+// ALTER TABLE statements finding their columns already present.
+func TestOpenMigrationsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "earbug.db")
+
+	s1, err := Open(ctx, path)
+	if err != nil {
+		t.Fatalf("first open: %v", err)
+	}
+	s1.Close()
+
+	s2, err := Open(ctx, path)
+	if err != nil {
+		t.Fatalf("second open: %v", err)
+	}
+	s2.Close()
+}
+
+func TestListPlaybacksFilters(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+
+	tracks := []*earbugv4.Track{
+		{Id: "t1", Uri: "spotify:track:t1", Name: "Blue Monday", Artists: []*earbugv4.Artist{{Id: "a1", Name: "New Order"}}},
+		{Id: "t2", Uri: "spotify:track:t2", Name: "Crazy", Artists: []*earbugv4.Artist{{Id: "a2", Name: "Gnarls Barkley"}}},
+	}
+	for _, tr := range tracks {
+		if err := s.PutTrack(ctx, tr); err != nil {
+			t.Fatalf("put track %s: %v", tr.Id, err)
+		}
+	}
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	plays := []struct {
+		start   time.Time
+		trackID string
+	}{
+		{base, "t1"},
+		{base.Add(time.Hour), "t2"},
+		{base.Add(2 * time.Hour), "t1"},
+	}
+	for _, p := range plays {
+		if _, err := s.PutPlayback(ctx, "spotify", p.start, &earbugv4.Playback{TrackId: p.trackID}); err != nil {
+			t.Fatalf("put playback: %v", err)
+		}
+	}
+
+	all, err := s.ListPlaybacks(ctx, Options{})
+	if err != nil {
+		t.Fatalf("list all: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("list all: got %d plays, want 3", len(all))
+	}
+	// newest first
+	if !all[0].StartTime.Equal(base.Add(2 * time.Hour)) {
+		t.Errorf("list all[0].StartTime = %v, want newest first", all[0].StartTime)
+	}
+
+	byTrack, err := s.ListPlaybacks(ctx, Options{Track: "crazy"})
+	if err != nil {
+		t.Fatalf("list by track: %v", err)
+	}
+	if len(byTrack) != 1 || byTrack[0].Track.Id != "t2" {
+		t.Fatalf("list by track = %+v, want one play of t2", byTrack)
+	}
+
+	byArtist, err := s.ListPlaybacks(ctx, Options{Artist: "new order"})
+	if err != nil {
+		t.Fatalf("list by artist: %v", err)
+	}
+	if len(byArtist) != 2 {
+		t.Fatalf("list by artist: got %d plays, want 2", len(byArtist))
+	}
+
+	byRange, err := s.ListPlaybacks(ctx, Options{From: base.Add(30 * time.Minute), To: base.Add(90 * time.Minute)})
+	if err != nil {
+		t.Fatalf("list by range: %v", err)
+	}
+	if len(byRange) != 1 || byRange[0].Track.Id != "t2" {
+		t.Fatalf("list by range = %+v, want one play of t2", byRange)
+	}
+}
+
+// TestImportTimeFallback confirms Import accepts both the RFC3339Nano
+// timestamps the v3 store writes natively and the plain RFC3339 ones some
+// older exports use.
+func TestImportTimeFallback(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t)
+
+	in := &earbugv4.Store{
+		Tracks: map[string]*earbugv4.Track{
+			"t1": {Id: "t1", Uri: "spotify:track:t1", Name: "Track One"},
+		},
+		Playbacks: map[string]*earbugv4.Playback{
+			"2026-01-01T00:00:00.123456789Z": {TrackId: "t1"},
+			"2026-01-01T01:00:00Z":           {TrackId: "t1"},
+		},
+	}
+	if err := s.Import(ctx, in); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	plays, err := s.ListPlaybacks(ctx, Options{})
+	if err != nil {
+		t.Fatalf("list playbacks: %v", err)
+	}
+	if len(plays) != 2 {
+		t.Fatalf("got %d plays, want 2", len(plays))
+	}
+}
@@ -17,8 +17,13 @@ type Cmd struct {
 	o observability.Config
 	c client.Config
 
+	service string
+
 	clientID     string
 	clientSecret string
+
+	lastfmAPIKey    string
+	lastfmAPISecret string
 }
 
 func (c *Cmd) Name() string     { return `authorize` }
@@ -28,6 +33,9 @@ func (c *Cmd) Usage() string {
 
 (re)authorize the server with new oauth client id/secret (optional) and oauth grant / token.
 
+Use -service=lastfm to instead obtain a last.fm session key for the
+scrobbler, which is printed for use with "serve -lastfm.session-key".
+
 Flags:
 `
 }
@@ -36,17 +44,25 @@ func (c *Cmd) SetFlags(f *flag.FlagSet) {
 	c.o.SetFlags(f)
 	c.c.SetFlags(f)
 
+	f.StringVar(&c.service, "service", "spotify", "service to authorize: spotify|lastfm")
 	f.StringVar(&c.clientID, "client.id", "", "spotify app oauth client id")
 	f.StringVar(&c.clientSecret, "client.secret", "", "spotify app oauth client secret")
+
+	f.StringVar(&c.lastfmAPIKey, "lastfm.api-key", "", "last.fm api key")
+	f.StringVar(&c.lastfmAPISecret, "lastfm.api-secret", "", "last.fm api secret")
 }
 
 func (c *Cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	o := observability.New(c.o)
-	e := client.New(c.c)
 
 	ctx, span := o.T.Start(ctx, "auth")
 	defer span.End()
 
+	if c.service == "lastfm" {
+		return c.authorizeLastFM(ctx, o)
+	}
+
+	e := client.New(c.c)
 	res, err := e.Authorize(ctx, &connect.Request[earbugv4.AuthorizeRequest]{
 		Msg: &earbugv4.AuthorizeRequest{
 			ClientId:     c.clientID,
@@ -0,0 +1,183 @@
+// Package importcmd reads Spotify's "Extended streaming history" GDPR
+// export files and streams them, chunked, to the v3 server's /import
+// endpoint (server/import.go).
+//
+// Every other subcommand in this tree talks to subcommands/serve's
+// earbugv4connect service; this one doesn't, because the history this
+// command backfills lives in the older server/server.go (a GCS-per-user
+// store predating Connect-RPC, see importHistory's doc comment there)
+// rather than the v4 SQLite store. There's no earbugv4 ImportHistory RPC
+// to call either way: the earbugv4 proto is generated outside this repo,
+// so this is a plain JSON-over-HTTP client instead of the usual
+// connect-go one, posting one chunk per request so a multi-GB export
+// never needs to be held in memory in full.
+package importcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/google/subcommands"
+)
+
+type Cmd struct {
+	server    string
+	user      string
+	glob      string
+	chunkSize int
+}
+
+func (c *Cmd) Name() string     { return `import` }
+func (c *Cmd) Synopsis() string { return `import a spotify "extended streaming history" gdpr export` }
+func (c *Cmd) Usage() string {
+	return `import [options...]
+
+stream a spotify gdpr export's json files to the server's /import endpoint.
+
+Flags:
+`
+}
+
+func (c *Cmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.server, "server", "", "base url of the server, e.g. https://earbug.example.com")
+	f.StringVar(&c.user, "user", "", "earbug user to import into")
+	f.StringVar(&c.glob, "glob", "Spotify Extended Streaming History/*.json", "glob matching exported json files")
+	f.IntVar(&c.chunkSize, "chunk-size", 5000, "entries per /import request, so multi-gb exports don't need to load in full")
+}
+
+// importEntry mirrors server.importEntry: one line of a GDPR export.
+type importEntry struct {
+	EndTime         string `json:"endTime,omitempty"`
+	Ts              string `json:"ts,omitempty"`
+	MsPlayed        int64  `json:"msPlayed"`
+	SpotifyTrackURI string `json:"spotifyTrackUri"`
+	ArtistName      string `json:"artistName"`
+	TrackName       string `json:"trackName"`
+	AlbumName       string `json:"albumName"`
+}
+
+type importReq struct {
+	User    string        `json:"user"`
+	Entries []importEntry `json:"entries"`
+}
+
+type importResp struct {
+	Imported int `json:"imported"`
+	Deduped  int `json:"deduped"`
+	Skipped  int `json:"skipped"`
+}
+
+func (c *Cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if c.server == "" || c.user == "" {
+		fmt.Fprintln(os.Stderr, "-server and -user are required")
+		return subcommands.ExitUsageError
+	}
+
+	files, err := filepath.Glob(c.glob)
+	if err != nil || len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "no files matched %s: %v\n", c.glob, err)
+		return subcommands.ExitFailure
+	}
+
+	var total importResp
+	for _, file := range files {
+		chunkN := 0
+		err := streamExportFile(file, c.chunkSize, func(entries []importEntry) error {
+			resp, err := c.importChunk(ctx, entries)
+			if err != nil {
+				return fmt.Errorf("import chunk %d: %w", chunkN, err)
+			}
+			chunkN++
+
+			total.Imported += resp.Imported
+			total.Deduped += resp.Deduped
+			total.Skipped += resp.Skipped
+			fmt.Printf("%s: imported=%d deduped=%d skipped=%d (running total imported=%d)\n",
+				file, resp.Imported, resp.Deduped, resp.Skipped, total.Imported)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read %s: %v\n", file, err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	fmt.Printf("done: imported=%d deduped=%d skipped=%d\n", total.Imported, total.Deduped, total.Skipped)
+	return subcommands.ExitSuccess
+}
+
+// streamExportFile decodes the JSON array at path one element at a time
+// and calls fn with each chunkSize-sized batch of entries (a shorter,
+// final batch included), so a multi-GB export never has its fully parsed
+// entries held in memory all at once, only one chunk's worth.
+func streamExportFile(path string, chunkSize int, fn func([]importEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	if _, err := dec.Token(); err != nil { // opening '['
+		return fmt.Errorf("read array start: %w", err)
+	}
+
+	chunk := make([]importEntry, 0, chunkSize)
+	for dec.More() {
+		var e importEntry
+		if err := dec.Decode(&e); err != nil {
+			return fmt.Errorf("decode entry: %w", err)
+		}
+		chunk = append(chunk, e)
+		if len(chunk) == chunkSize {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+	if len(chunk) > 0 {
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+
+	if _, err := dec.Token(); err != nil { // closing ']'
+		return fmt.Errorf("read array end: %w", err)
+	}
+	return nil
+}
+
+func (c *Cmd) importChunk(ctx context.Context, entries []importEntry) (importResp, error) {
+	b, err := json.Marshal(importReq{User: c.user, Entries: entries})
+	if err != nil {
+		return importResp{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.server+"/import", bytes.NewReader(b))
+	if err != nil {
+		return importResp{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return importResp{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return importResp{}, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	var resp importResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return importResp{}, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,64 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+)
+
+// writeM3U and writeJSPF convert a ReportPlayed response into a playlist,
+// the same formats subcommands/serve's /playbacks/export (?format=m3u or
+// ?format=jspf) produces. chunk1-5 asked for an ExportPlaylist RPC instead; see
+// server/server.go's package doc comment for why none was added (same
+// vendored-proto constraint, flagged there as a scope cut spanning
+// several requests). ReportPlayedResponse_Track also carries no duration,
+// so unlike the server's playlist export, EXTINF reports -1 (m3u's
+// "unknown duration") and the JSPF track omits "duration".
+func writeM3U(plays []*earbugv4.ReportPlayedResponse_Playback) {
+	fmt.Println("#EXTM3U")
+	for _, play := range plays {
+		fmt.Printf("#EXTINF:-1,%s - %s\n", artistName(play), play.Track.Name)
+		fmt.Printf("spotify:track:%s\n", play.Track.Id)
+	}
+}
+
+type jspf struct {
+	Playlist jspfPlaylist `json:"playlist"`
+}
+
+type jspfPlaylist struct {
+	Title string      `json:"title"`
+	Track []jspfTrack `json:"track"`
+}
+
+type jspfTrack struct {
+	Title      string   `json:"title"`
+	Creator    string   `json:"creator"`
+	Identifier []string `json:"identifier"`
+	Location   []string `json:"location"`
+}
+
+func writeJSPF(plays []*earbugv4.ReportPlayedResponse_Playback) {
+	pl := jspf{Playlist: jspfPlaylist{Title: "earbug"}}
+	for _, play := range plays {
+		location := fmt.Sprintf("spotify:track:%s", play.Track.Id)
+		pl.Playlist.Track = append(pl.Playlist.Track, jspfTrack{
+			Title:      play.Track.Name,
+			Creator:    artistName(play),
+			Identifier: []string{location},
+			Location:   []string{location},
+		})
+	}
+	json.NewEncoder(os.Stdout).Encode(pl)
+}
+
+func artistName(play *earbugv4.ReportPlayedResponse_Playback) string {
+	names := make([]string, len(play.Artists))
+	for i, artist := range play.Artists {
+		names[i] = artist.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -19,7 +19,8 @@ type Cmd struct {
 	o observability.Config
 	c client.Config
 
-	since *timestamppb.Timestamp
+	since  *timestamppb.Timestamp
+	format string
 }
 
 func (c *Cmd) Name() string     { return `report` }
@@ -45,6 +46,7 @@ func (c *Cmd) SetFlags(f *flag.FlagSet) {
 		c.since = timestamppb.New(t)
 		return nil
 	})
+	f.StringVar(&c.format, "format", "tsv", "output format: tsv, m3u, or jspf")
 }
 
 func (c *Cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
@@ -63,8 +65,17 @@ func (c *Cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcomm
 		o.L.LogAttrs(ctx, slog.LevelError, "get recently played", slog.String("error", err.Error()))
 		return subcommands.ExitFailure
 	}
-	for _, play := range res.Msg.Playbacks {
-		fmt.Printf("%s\t%s\n", play.Track.Name, play.Artists[0].Name)
+	switch c.format {
+	case "m3u":
+		writeM3U(res.Msg.Playbacks)
+	case "jspf":
+		writeJSPF(res.Msg.Playbacks)
+	case "tsv":
+		fallthrough
+	default:
+		for _, play := range res.Msg.Playbacks {
+			fmt.Printf("%s\t%s\n", play.Track.Name, play.Artists[0].Name)
+		}
 	}
 
 	return subcommands.ExitSuccess
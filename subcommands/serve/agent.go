@@ -0,0 +1,56 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+)
+
+// AgentPlayback is a single observed play, independent of which music
+// source produced it.
+type AgentPlayback struct {
+	StartTime   time.Time
+	Track       *earbugv4.Track
+	ContextType string
+	ContextURI  string
+}
+
+// Agent is a music source that can report recently played tracks. Spotify
+// is the first implementation; others (e.g. ListenBrainz) register under
+// their own name and are selected with the -agents flag.
+type Agent interface {
+	// Name identifies the agent, and is used as the playback source for
+	// deduping across agents.
+	Name() string
+	RecentlyPlayed(ctx context.Context, since time.Time) ([]AgentPlayback, error)
+}
+
+// AgentFactory constructs an Agent from a server once it is configured.
+type AgentFactory func(s *Server) (Agent, error)
+
+var agentFactories = map[string]AgentFactory{}
+
+// RegisterAgent makes an agent available to the -agents flag under name.
+// Called from init in each agent's file.
+func RegisterAgent(name string, f AgentFactory) {
+	agentFactories[name] = f
+}
+
+// buildAgents constructs the ordered, enabled agent list named by names.
+func buildAgents(s *Server, names []string) ([]Agent, error) {
+	var agents []Agent
+	for _, name := range names {
+		f, ok := agentFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown agent %q", name)
+		}
+		a, err := f(s)
+		if err != nil {
+			return nil, fmt.Errorf("construct agent %q: %w", name, err)
+		}
+		agents = append(agents, a)
+	}
+	return agents, nil
+}
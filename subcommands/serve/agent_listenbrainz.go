@@ -0,0 +1,113 @@
+package serve
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+)
+
+func init() {
+	RegisterAgent("listenbrainz", func(s *Server) (Agent, error) {
+		if s.listenbrainzUser == "" {
+			return nil, fmt.Errorf("no listenbrainz user configured, set -listenbrainz.user")
+		}
+		return &listenBrainzAgent{
+			http: &http.Client{},
+			user: s.listenbrainzUser,
+		}, nil
+	})
+}
+
+// listenBrainzAgent pulls a user's own listen history back out of
+// ListenBrainz, so a ListenBrainz-only listening session (e.g. from a
+// player that scrobbles there directly) still shows up in earbug.
+type listenBrainzAgent struct {
+	http *http.Client
+	user string
+}
+
+func (a *listenBrainzAgent) Name() string { return "listenbrainz" }
+
+type listenBrainzListensResponse struct {
+	Payload struct {
+		Listens []struct {
+			ListenedAt    int64 `json:"listened_at"`
+			TrackMetadata struct {
+				ArtistName     string `json:"artist_name"`
+				TrackName      string `json:"track_name"`
+				AdditionalInfo struct {
+					SpotifyID string `json:"spotify_id"`
+				} `json:"additional_info"`
+			} `json:"track_metadata"`
+		} `json:"listens"`
+	} `json:"payload"`
+}
+
+func (a *listenBrainzAgent) RecentlyPlayed(ctx context.Context, since time.Time) ([]AgentPlayback, error) {
+	url := fmt.Sprintf("https://api.listenbrainz.org/1/user/%s/listens", a.user)
+	if !since.IsZero() {
+		url += fmt.Sprintf("?min_ts=%d", since.Unix())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	res, err := a.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listenbrainz: unexpected status %s", res.Status)
+	}
+
+	var out listenBrainzListensResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	plays := make([]AgentPlayback, 0, len(out.Payload.Listens))
+	for _, listen := range out.Payload.Listens {
+		id := listen.TrackMetadata.AdditionalInfo.SpotifyID
+		if id == "" {
+			// ListenBrainz only fills in spotify_id for listens submitted
+			// from Spotify; every other source (a desktop player scrobbling
+			// directly, say) has no SpotifyID at all. Falling through to an
+			// empty string would collide every such track on the same
+			// tracks.id primary key, silently losing all but the first
+			// one's name/artists, so derive a stable id from the metadata
+			// ListenBrainz does always provide instead.
+			id = listenBrainzSyntheticTrackID(listen.TrackMetadata.ArtistName, listen.TrackMetadata.TrackName)
+		}
+		t := &earbugv4.Track{
+			Id:   id,
+			Name: listen.TrackMetadata.TrackName,
+		}
+		if listen.TrackMetadata.ArtistName != "" {
+			t.Artists = []*earbugv4.Artist{{Name: listen.TrackMetadata.ArtistName}}
+		}
+		plays = append(plays, AgentPlayback{
+			StartTime: time.Unix(listen.ListenedAt, 0),
+			Track:     t,
+		})
+	}
+	return plays, nil
+}
+
+// listenBrainzSyntheticTrackID derives a stable tracks.id for a listen
+// ListenBrainz didn't tag with a Spotify track id, so the same (artist,
+// track) pair always maps to the same row instead of every untagged track
+// colliding on an empty id.
+func listenBrainzSyntheticTrackID(artist, track string) string {
+	h := md5.New()
+	h.Write([]byte(artist))
+	h.Write([]byte("\x00"))
+	h.Write([]byte(track))
+	return "listenbrainz:" + hex.EncodeToString(h.Sum(nil))
+}
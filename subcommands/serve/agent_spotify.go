@@ -0,0 +1,60 @@
+package serve
+
+import (
+	"context"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func init() {
+	RegisterAgent("spotify", func(s *Server) (Agent, error) {
+		return &spotifyAgent{s: s}, nil
+	})
+}
+
+// spotifyAgent adapts the Spotify client already authorized on Server to
+// the Agent interface.
+type spotifyAgent struct {
+	s *Server
+}
+
+func (a *spotifyAgent) Name() string { return "spotify" }
+
+func (a *spotifyAgent) RecentlyPlayed(ctx context.Context, since time.Time) ([]AgentPlayback, error) {
+	opt := &spotify.RecentlyPlayedOptions{Limit: 50}
+	if !since.IsZero() {
+		opt.AfterEpochMs = since.UnixMilli()
+	}
+	items, err := a.s.spot.PlayerRecentlyPlayedOpt(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	plays := make([]AgentPlayback, 0, len(items))
+	for _, item := range items {
+		t := &earbugv4.Track{
+			Id:       item.Track.ID.String(),
+			Uri:      string(item.Track.URI),
+			Type:     item.Track.Type,
+			Name:     item.Track.Name,
+			Duration: durationpb.New(item.Track.TimeDuration()),
+		}
+		for _, artist := range item.Track.Artists {
+			t.Artists = append(t.Artists, &earbugv4.Artist{
+				Id:   artist.ID.String(),
+				Uri:  string(artist.URI),
+				Name: artist.Name,
+			})
+		}
+		plays = append(plays, AgentPlayback{
+			StartTime:   item.PlayedAt,
+			Track:       t,
+			ContextType: item.PlaybackContext.Type,
+			ContextURI:  string(item.PlaybackContext.URI),
+		})
+	}
+	return plays, nil
+}
@@ -5,12 +5,14 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/zmb3/spotify/v2"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.seankhliao.com/earbug/v4/scrobble"
 	earbugv4 "go.seankhliao.com/proto/earbug/v4"
 	"golang.org/x/oauth2"
 	oauthspotify "golang.org/x/oauth2/spotify"
@@ -21,22 +23,19 @@ func (s *Server) Authorize(ctx context.Context, r *connect.Request[earbugv4.Auth
 	defer span.End()
 
 	clientID, clientSecret := func() (clientID, clientSecret string) {
-		s.storemu.Lock()
-		defer s.storemu.Unlock()
+		s.authmu.Lock()
+		defer s.authmu.Unlock()
 		clientID = r.Msg.ClientId
-		if clientID == "" && (s.store.Auth != nil && s.store.Auth.ClientId != "") {
-			clientID = s.store.Auth.ClientId
+		if clientID == "" && s.auth.ClientId != "" {
+			clientID = s.auth.ClientId
 		} else {
-			if s.store.Auth == nil {
-				s.store.Auth = &earbugv4.Auth{}
-			}
-			s.store.Auth.ClientId = clientID
+			s.auth.ClientId = clientID
 		}
 		clientSecret = r.Msg.ClientSecret
-		if clientSecret == "" && (s.store.Auth != nil && s.store.Auth.ClientSecret != "") {
-			clientSecret = s.store.Auth.ClientSecret
+		if clientSecret == "" && s.auth.ClientSecret != "" {
+			clientSecret = s.auth.ClientSecret
 		} else {
-			s.store.Auth.ClientSecret = clientSecret
+			s.auth.ClientSecret = clientSecret
 		}
 		return
 	}()
@@ -77,15 +76,66 @@ func (s *Server) hAuthCallback(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	func() {
-		s.storemu.Lock()
-		defer s.storemu.Unlock()
-		s.store.Auth.Token = tokenMarshaled
+		s.authmu.Lock()
+		defer s.authmu.Unlock()
+		s.auth.Token = tokenMarshaled
 		s.spot = spotClient
 	}()
 
 	rw.Write([]byte("success"))
 }
 
+// hAuthCallbackLastFM completes the last.fm "desktop" auth flow: given the
+// token granted by the user at last.fm's auth URL, exchange it for a
+// session key and hand it to the running scrobbler.
+func (s *Server) hAuthCallbackLastFM(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := s.o.T.Start(r.Context(), "hAuthCallbackLastFM")
+	defer span.End()
+
+	if s.lastfmScrobbler == nil {
+		s.o.HTTPErr(ctx, "last.fm scrobbling not enabled", errors.New("missing -lastfm.enabled"), rw, http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		s.o.HTTPErr(ctx, "missing token", errors.New("token is required"), rw, http.StatusBadRequest)
+		return
+	}
+
+	sessionKey, err := scrobble.LastFMGetSession(ctx, s.lastfmAPIKey, s.lastfmAPISecret, token)
+	if err != nil {
+		s.o.HTTPErr(ctx, "get last.fm session", err, rw, http.StatusBadGateway)
+		return
+	}
+	s.lastfmScrobbler.SetSessionKey(sessionKey)
+
+	rw.Write([]byte("success"))
+}
+
+// hAuthCallbackListenBrainz hands a freshly generated ListenBrainz user
+// token to the running scrobbler. ListenBrainz has no OAuth redirect of
+// its own, so unlike hAuthCallback this is just the token, pasted by the
+// user from their ListenBrainz profile settings.
+func (s *Server) hAuthCallbackListenBrainz(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := s.o.T.Start(r.Context(), "hAuthCallbackListenBrainz")
+	defer span.End()
+
+	if s.listenbrainzScrobbler == nil {
+		s.o.HTTPErr(ctx, "listenbrainz scrobbling not enabled", errors.New("missing -listenbrainz.enabled"), rw, http.StatusBadRequest)
+		return
+	}
+
+	token := r.FormValue("user_token")
+	if token == "" {
+		s.o.HTTPErr(ctx, "missing user_token", errors.New("user_token is required"), rw, http.StatusBadRequest)
+		return
+	}
+	s.listenbrainzScrobbler.SetUserToken(token)
+
+	rw.Write([]byte("success"))
+}
+
 type AuthState struct {
 	state string
 	conf  *oauth2.Config
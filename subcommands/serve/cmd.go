@@ -3,16 +3,37 @@ package serve
 import (
 	"context"
 	"flag"
+	"time"
 
 	"github.com/google/subcommands"
 	"go.seankhliao.com/svcrunner/v2/tshttp"
 )
 
 type Cmd struct {
+	// tshttp also owns logging (handler format, add-source, etc.) via its
+	// own SetFlags below; it's a separate, external observability setup
+	// from go.seankhliao.com/earbug/v4/observability (vendored with no
+	// local source for this package to add flags to or thread new ones
+	// through), so -log.format/-log.addSource as added there don't apply
+	// to serve.
 	tshttp tshttp.Config
 
 	bucket string
 	key    string
+	dbPath string
+
+	sessionIdleGap time.Duration
+
+	lastfmEnabled    bool
+	lastfmAPIKey     string
+	lastfmAPISecret  string
+	lastfmSessionKey string
+
+	listenbrainzEnabled bool
+	listenbrainzToken   string
+
+	agents           string
+	listenbrainzUser string
 }
 
 func (c *Cmd) Name() string     { return `serve` }
@@ -28,8 +49,21 @@ Flags:
 
 func (c *Cmd) SetFlags(f *flag.FlagSet) {
 	c.tshttp.SetFlags(f)
-	f.StringVar(&c.bucket, "data.init.bucket", "", "bucket to load initial data from")
+	f.StringVar(&c.bucket, "data.init.bucket", "", "bucket to load initial data from, for one-time import into the sqlite store")
 	f.StringVar(&c.key, "data.init.key", "", "key to load initial data from")
+	f.StringVar(&c.dbPath, "data.sqlite", "earbug.db", "path to the sqlite database")
+	f.DurationVar(&c.sessionIdleGap, "sessions.idle-gap", 30*time.Minute, "gap between plays after which /sessions starts a new listening session")
+
+	f.BoolVar(&c.lastfmEnabled, "lastfm.enabled", false, "mirror playbacks to last.fm")
+	f.StringVar(&c.lastfmAPIKey, "lastfm.api-key", "", "last.fm api key")
+	f.StringVar(&c.lastfmAPISecret, "lastfm.api-secret", "", "last.fm api secret")
+	f.StringVar(&c.lastfmSessionKey, "lastfm.session-key", "", "last.fm session key, from the authorize subcommand")
+
+	f.BoolVar(&c.listenbrainzEnabled, "listenbrainz.enabled", false, "mirror playbacks to listenbrainz")
+	f.StringVar(&c.listenbrainzToken, "listenbrainz.user-token", "", "listenbrainz user token")
+
+	f.StringVar(&c.agents, "agents", "spotify", "comma separated list of music source agents to poll for recently played tracks")
+	f.StringVar(&c.listenbrainzUser, "listenbrainz.user", "", "listenbrainz username to pull listen history from, for the listenbrainz agent")
 }
 
 func (c *Cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
@@ -16,10 +16,17 @@ func (s *Server) Export(ctx context.Context, r *connect.Request[earbugv4.ExportR
 	ctx, span := s.o.T.Start(ctx, "Export")
 	defer span.End()
 
-	s.storemu.Lock()
-	b, err := proto.Marshal(&s.store)
-	s.storemu.Unlock()
+	store, err := s.store.Export(ctx)
+	if err != nil {
+		return nil, s.o.markErr(ctx, "read store", err)
+	}
+
+	s.authmu.Lock()
+	auth := s.auth
+	s.authmu.Unlock()
+	store.Auth = &auth
 
+	b, err := proto.Marshal(store)
 	if err != nil {
 		return nil, s.o.markErr(ctx, "marshal store", err)
 	}
@@ -0,0 +1,77 @@
+package serve
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type loggerCtxKey struct{}
+
+// loggerFromContext returns the request-scoped logger attached by
+// logMiddleware, correlated with the current request's trace/span id, or
+// fallback if the context carries none (e.g. a handler called directly).
+func loggerFromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(loggerCtxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return fallback
+}
+
+// statusWriter records the status code and bytes written by a handler, so
+// logMiddleware can include them in the access log after the handler
+// returns.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// logMiddleware wraps next with a structured access log emitted via o.L,
+// and attaches a request-scoped *slog.Logger carrying correlated fields
+// (trace/span id, method, path, remote addr) to the request context, so
+// downstream handlers can log with those fields instead of the bare
+// server logger.
+func (s *Server) logMiddleware(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		sc := trace.SpanContextFromContext(r.Context())
+		l := s.o.L.With(
+			slog.String("handler", name),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("remoteAddr", r.RemoteAddr),
+			slog.String("traceId", sc.TraceID().String()),
+			slog.String("spanId", sc.SpanID().String()),
+		)
+		ctx := context.WithValue(r.Context(), loggerCtxKey{}, l)
+		r = r.WithContext(ctx)
+
+		sw := &statusWriter{ResponseWriter: rw}
+		next(sw, r)
+
+		l.LogAttrs(ctx, slog.LevelInfo, "http request",
+			slog.Int("status", sw.status),
+			slog.Int("bytes", sw.bytes),
+			slog.Duration("duration", time.Since(start)),
+		)
+	}
+}
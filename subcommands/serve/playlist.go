@@ -0,0 +1,61 @@
+package serve
+
+import (
+	"net/http"
+	"strings"
+
+	"go.seankhliao.com/earbug/v4/playlist"
+)
+
+// toPlaylistTracks adapts getPlaybacks's Playback rows into the shape the
+// shared playlist package renders, since Playback itself carries an
+// earbugv4.Track, not the plain fields playlist.Track needs.
+func toPlaylistTracks(plays []Playback) []playlist.Track {
+	out := make([]playlist.Track, len(plays))
+	for i, p := range plays {
+		var artists []string
+		for _, artist := range p.Track.Artists {
+			artists = append(artists, artist.Name)
+		}
+		out[i] = playlist.Track{
+			Name:      p.Track.Name,
+			Artists:   artists,
+			SpotifyID: p.Track.Id,
+			Duration:  p.Track.Duration.AsDuration(),
+		}
+	}
+	return out
+}
+
+// handlePlaylistExport renders the filtered playback listing as a playlist,
+// so it can be re-imported into Spotify or other players. The format is
+// selected by ?format= (m3u|jspf), falling back to the Accept header and
+// defaulting to m3u.
+func (s *Server) handlePlaylistExport(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := s.o.T.Start(r.Context(), "handlePlaylistExport")
+	defer span.End()
+
+	plays := s.getPlaybacks(ctx, optionsFromRequest(r))
+	tracks := toPlaylistTracks(plays)
+
+	switch playlistFormat(r) {
+	case "jspf":
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Disposition", `attachment; filename="earbug.jspf"`)
+		playlist.WriteJSPF(rw, tracks)
+	default:
+		rw.Header().Set("Content-Type", "audio/x-mpegurl")
+		rw.Header().Set("Content-Disposition", `attachment; filename="earbug.m3u"`)
+		playlist.WriteM3U(rw, tracks)
+	}
+}
+
+func playlistFormat(r *http.Request) string {
+	if f := r.FormValue("format"); f != "" {
+		return f
+	}
+	if strings.Contains(r.Header.Get("Accept"), "jspf") || strings.Contains(r.Header.Get("Accept"), "json") {
+		return "jspf"
+	}
+	return "m3u"
+}
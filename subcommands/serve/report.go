@@ -2,50 +2,40 @@ package serve
 
 import (
 	"context"
-	"sort"
-	"time"
 
 	"github.com/bufbuild/connect-go"
+	"go.seankhliao.com/earbug/v4/store"
 	earbugv4 "go.seankhliao.com/proto/earbug/v4"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func (s *Server) ReportPlayed(ctx context.Context, r *connect.Request[earbugv4.ReportPlayedRequest]) (*connect.Response[earbugv4.ReportPlayedResponse], error) {
-	_, span := s.o.T.Start(ctx, "ReportPlayed")
+	ctx, span := s.o.T.Start(ctx, "ReportPlayed")
 	defer span.End()
 
-	since := r.Msg.Since.AsTime().Format(time.RFC3339)
-	var plays []*earbugv4.ReportPlayedResponse_Playback
-
-	s.storemu.Lock()
-	for ts, play := range s.store.Playbacks {
-		if ts < since {
-			continue
-		}
-		startTime, _ := time.Parse(time.RFC3339, ts)
+	rows, err := s.store.ListPlaybacks(ctx, store.Options{From: r.Msg.Since.AsTime()})
+	if err != nil {
+		return nil, s.o.Err(ctx, "list playbacks", err)
+	}
 
-		track := s.store.Tracks[play.TrackId]
+	var plays []*earbugv4.ReportPlayedResponse_Playback
+	for _, row := range rows {
 		var artists []*earbugv4.ReportPlayedResponse_Artist
-		for _, artist := range track.Artists {
+		for _, artist := range row.Track.Artists {
 			artists = append(artists, &earbugv4.ReportPlayedResponse_Artist{
 				Id:   artist.Id,
 				Name: artist.Name,
 			})
 		}
 		plays = append(plays, &earbugv4.ReportPlayedResponse_Playback{
-			StartTime: timestamppb.New(startTime),
+			StartTime: timestamppb.New(row.StartTime),
 			Track: &earbugv4.ReportPlayedResponse_Track{
-				Id:   track.Id,
-				Name: track.Name,
+				Id:   row.Track.Id,
+				Name: row.Track.Name,
 			},
 			Artists: artists,
 		})
 	}
-	s.storemu.Unlock()
-
-	sort.Slice(plays, func(i, j int) bool {
-		return plays[i].StartTime.AsTime().After(plays[j].StartTime.AsTime())
-	})
 
 	return &connect.Response[earbugv4.ReportPlayedResponse]{
 		Msg: &earbugv4.ReportPlayedResponse{
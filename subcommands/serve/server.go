@@ -6,12 +6,16 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/klauspost/compress/zstd"
 	"github.com/zmb3/spotify/v2"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.seankhliao.com/earbug/v4/scrobble"
+	"go.seankhliao.com/earbug/v4/store"
 	earbugv4 "go.seankhliao.com/proto/earbug/v4"
 	"go.seankhliao.com/proto/earbug/v4/earbugv4connect"
 	"go.seankhliao.com/svcrunner/v2/observability"
@@ -30,14 +34,27 @@ type Server struct {
 	svr  *tshttp.Server
 	spot *spotify.Client
 
-	storemu sync.Mutex
-	store   earbugv4.Store
+	store *store.Store
+
+	authmu sync.Mutex
+	auth   earbugv4.Auth
 
 	authURL   string
 	authState atomic.Pointer[AuthState]
 
 	render webstyle.Renderer
 
+	scrobblers            *scrobble.Scrobblers
+	lastfmScrobbler       *scrobble.LastFMScrobbler
+	lastfmAPIKey          string
+	lastfmAPISecret       string
+	listenbrainzScrobbler *scrobble.ListenBrainzScrobbler
+
+	agents           []Agent
+	listenbrainzUser string
+
+	sessionIdleGap time.Duration
+
 	earbugv4connect.UnimplementedEarbugServiceHandler
 }
 
@@ -47,80 +64,136 @@ func New(ctx context.Context, c *Cmd) *Server {
 		o:   svr.O,
 		svr: svr,
 
+		listenbrainzUser: c.listenbrainzUser,
+		sessionIdleGap:   c.sessionIdleGap,
+
 		render: webstyle.NewRenderer(webstyle.TemplateCompact),
 	}
 
+	httpClient := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	var scrobblerList []scrobble.Scrobbler
+	if c.lastfmEnabled {
+		s.lastfmScrobbler = scrobble.NewLastFMScrobbler(httpClient, c.lastfmAPIKey, c.lastfmAPISecret, c.lastfmSessionKey)
+		s.lastfmAPIKey = c.lastfmAPIKey
+		s.lastfmAPISecret = c.lastfmAPISecret
+		scrobblerList = append(scrobblerList, s.lastfmScrobbler)
+	}
+	if c.listenbrainzEnabled {
+		s.listenbrainzScrobbler = scrobble.NewListenBrainzScrobbler(httpClient, c.listenbrainzToken)
+		scrobblerList = append(scrobblerList, s.listenbrainzScrobbler)
+	}
+
 	p, h := earbugv4connect.NewEarbugServiceHandler(s)
 	svr.Mux.Handle(p, otelhttp.NewHandler(h, "earbugv4connect"))
-	svr.Mux.Handle("/auth/callback", otelhttp.NewHandler(http.HandlerFunc(s.hAuthCallback), "authCallback"))
+	svr.Mux.HandleFunc("/auth/callback", s.logMiddleware("authCallback", s.hAuthCallback))
+	svr.Mux.HandleFunc("/api/auth/lastfm", s.logMiddleware("authCallbackLastFM", s.hAuthCallbackLastFM))
+	svr.Mux.HandleFunc("/api/auth/listenbrainz", s.logMiddleware("authCallbackListenBrainz", s.hAuthCallbackListenBrainz))
 	svr.Mux.HandleFunc("/-/ready", func(rw http.ResponseWriter, r *http.Request) { rw.Write([]byte("ok")) })
-	svr.Mux.HandleFunc("/", s.handleIndex)
-	svr.Mux.HandleFunc("/artists", s.handleArtists)
-	svr.Mux.HandleFunc("/playbacks", s.handlePlaybacks)
-	svr.Mux.HandleFunc("/tracks", s.handleTracks)
-
-	s.initData(ctx, c.bucket, c.key)
+	svr.Mux.HandleFunc("/", s.logMiddleware("index", s.handleIndex))
+	svr.Mux.HandleFunc("/artists", s.logMiddleware("artists", s.handleArtists))
+	svr.Mux.HandleFunc("/playbacks", s.logMiddleware("playbacks", s.handlePlaybacks))
+	svr.Mux.HandleFunc("/tracks", s.logMiddleware("tracks", s.handleTracks))
+	svr.Mux.HandleFunc("/playbacks/export", s.logMiddleware("playbacksExport", s.handlePlaylistExport))
+	svr.Mux.HandleFunc("/stats", s.logMiddleware("stats", s.handleStats))
+	svr.Mux.HandleFunc("/stats.json", s.logMiddleware("statsJSON", s.handleStatsJSON))
+	svr.Mux.HandleFunc("/sessions", s.logMiddleware("sessions", s.handleSessions))
+
+	s.initData(ctx, c.bucket, c.key, c.dbPath)
+	s.scrobblers = scrobble.New(s.o.L, s.store, scrobblerList...)
+
+	agents, err := buildAgents(s, strings.Split(c.agents, ","))
+	if err != nil {
+		s.o.Err(ctx, "build agents", err)
+	}
+	s.agents = agents
 
 	return s
 }
 
-func (s *Server) initData(ctx context.Context, bucket, key string) error {
+func (s *Server) initData(ctx context.Context, bucket, key, dbPath string) error {
 	ctx, span := s.o.T.Start(ctx, "initData")
 	defer span.End()
 
+	db, err := store.Open(ctx, dbPath)
+	if err != nil {
+		return s.o.Err(ctx, "open sqlite store", err)
+	}
+	s.store = db
+
 	if bucket != "" && key != "" {
-		bkt, err := blob.OpenBucket(ctx, bucket)
-		if err != nil {
-			return s.o.Err(ctx, "open bucket", err)
-		}
-		defer bkt.Close()
-		or, err := bkt.NewReader(ctx, key, nil)
-		if err != nil {
-			return s.o.Err(ctx, "open object", err)
-		}
-		defer or.Close()
-		zr, err := zstd.NewReader(or)
+		legacy, err := s.importLegacyBlob(ctx, bucket, key)
 		if err != nil {
-			return s.o.Err(ctx, "new zstd reader", err)
+			return s.o.Err(ctx, "import legacy blob", err)
 		}
-		defer or.Close()
-		b, err := io.ReadAll(zr)
-		if err != nil {
-			return s.o.Err(ctx, "read object", err)
-		}
-		err = proto.Unmarshal(b, &s.store)
-		if err != nil {
-			return s.o.Err(ctx, "unmarshal store", err)
+		if legacy.Auth != nil {
+			s.auth = *legacy.Auth
 		}
+	} else {
+		s.o.L.LogAttrs(ctx, slog.LevelWarn, "no initial data provided")
+	}
 
-		var token oauth2.Token
-		if s.store.Auth != nil && len(s.store.Auth.Token) > 0 {
-			rawToken := s.store.Auth.Token // new value
-			err = json.Unmarshal(rawToken, &token)
-			if err != nil {
-				return s.o.Err(ctx, "unmarshal oauth token", err)
-			}
-		} else {
-			s.o.L.LogAttrs(ctx, slog.LevelWarn, "no auth token found")
+	var token oauth2.Token
+	if len(s.auth.Token) > 0 {
+		if err := json.Unmarshal(s.auth.Token, &token); err != nil {
+			return s.o.Err(ctx, "unmarshal oauth token", err)
 		}
+	} else {
+		s.o.L.LogAttrs(ctx, slog.LevelWarn, "no auth token found")
+	}
+
+	httpClient := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	as := NewAuthState(s.auth.ClientId, s.auth.ClientSecret, "")
+	httpClient = as.conf.Client(ctx, &token)
+	s.spot = spotify.New(httpClient)
+
+	return nil
+}
 
-		httpClient := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
-		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
-		as := NewAuthState(s.store.Auth.ClientId, s.store.Auth.ClientSecret, "")
-		httpClient = as.conf.Client(ctx, &token)
-		s.spot = spotify.New(httpClient)
+// importLegacyBlob seeds the sqlite store from the previous single-blob
+// zstd/protobuf export, so existing deployments migrate without losing
+// history, and hands back its Auth regardless, since that's the only
+// place the OAuth token/client credentials are persisted across restarts
+// (there's no sqlite column for them). The store.Import pass itself only
+// runs once, gated on the sqlite store being empty, rather than
+// redownloading and reinserting the full legacy blob (idempotently, but
+// at ever-growing cost as history accumulates) on every restart.
+func (s *Server) importLegacyBlob(ctx context.Context, bucket, key string) (*earbugv4.Store, error) {
+	bkt, err := blob.OpenBucket(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer bkt.Close()
+	or, err := bkt.NewReader(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer or.Close()
+	zr, err := zstd.NewReader(or)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
 
-		return nil
+	var legacy earbugv4.Store
+	if err := proto.Unmarshal(b, &legacy); err != nil {
+		return nil, err
 	}
 
-	s.o.L.LogAttrs(ctx, slog.LevelWarn, "no initial data provided")
-	s.spot = spotify.New(http.DefaultClient)
-	s.store = earbugv4.Store{
-		Playbacks: make(map[string]*earbugv4.Playback),
-		Tracks:    make(map[string]*earbugv4.Track),
-		Auth:      &earbugv4.Auth{},
+	empty, err := s.store.Empty(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	if empty {
+		if err := s.store.Import(ctx, &legacy); err != nil {
+			return nil, err
+		}
+	}
+	return &legacy, nil
 }
 
 func (s *Server) Run(ctx context.Context) error {
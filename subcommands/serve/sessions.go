@@ -0,0 +1,66 @@
+package serve
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"go.seankhliao.com/earbug/v4/sessions"
+	"go.seankhliao.com/webstyle"
+)
+
+// toSessionPlays adapts getPlaybacks's Playback rows into the shape the
+// shared sessions package groups, since Playback itself carries an
+// earbugv4.Track, not the plain id sessions.Play needs.
+func toSessionPlays(plays []Playback) []sessions.Play {
+	out := make([]sessions.Play, len(plays))
+	for i, p := range plays {
+		sp := sessions.Play{
+			StartTime:    p.StartTime,
+			PlaybackTime: p.PlaybackTime,
+			TrackID:      p.Track.Id,
+			ContextURI:   p.ContextURI,
+		}
+		for _, artist := range p.Track.Artists {
+			sp.ArtistIDs = append(sp.ArtistIDs, artist.Id)
+		}
+		out[i] = sp
+	}
+	return out
+}
+
+func (s *Server) handleSessions(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := s.o.T.Start(r.Context(), "handleSessions")
+	defer span.End()
+
+	plays := s.getPlaybacks(ctx, optionsFromRequest(r))
+	sess := sessions.Compute(toSessionPlays(plays), s.sessionIdleGap)
+
+	var buf bytes.Buffer
+	buf.WriteString("### Sessions\n\n")
+	buf.WriteString("<table><thead><tr><th>start<th>end<th>listen time<th>plays<th>artists<th>tracks<th>context</tr></thead>\n<tbody>")
+	for _, one := range sess {
+		buf.WriteString("<tr><td>")
+		buf.WriteString(one.Start.String())
+		buf.WriteString("<td>")
+		buf.WriteString(one.End.String())
+		buf.WriteString("<td>")
+		buf.WriteString(one.ListenTime.String())
+		buf.WriteString("<td>")
+		buf.WriteString(strconv.Itoa(one.Plays))
+		buf.WriteString("<td>")
+		buf.WriteString(strconv.Itoa(one.DistinctArtists))
+		buf.WriteString("<td>")
+		buf.WriteString(strconv.Itoa(one.DistinctTracks))
+		buf.WriteString("<td>")
+		buf.WriteString(one.DominantContext)
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</tbody></table>")
+
+	err := s.render.Render(rw, &buf, webstyle.Data{})
+	if err != nil {
+		s.o.HTTPErr(ctx, "render", err, rw, http.StatusInternalServerError)
+		return
+	}
+}
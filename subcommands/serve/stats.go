@@ -0,0 +1,245 @@
+package serve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"go.seankhliao.com/webstyle"
+)
+
+// statsData is a single-pass aggregation over a window of playbacks: a
+// handful of time-bucketed histograms plus top-N artist/track charts, so
+// /stats and /stats.json can share one scan regardless of store size.
+type statsData struct {
+	ByHourOfDay [24]int  `json:"byHourOfDay"`
+	ByWeekday   [7]int   `json:"byWeekday"`
+	ByWeek      []bucket `json:"byWeek"`
+	ByMonth     []bucket `json:"byMonth"`
+
+	TopArtists []statsNamed `json:"topArtists"`
+	TopTracks  []statsNamed `json:"topTracks"`
+}
+
+type bucket struct {
+	Label string `json:"label"`
+	Plays int    `json:"plays"`
+}
+
+type statsNamed struct {
+	Name  string `json:"name"`
+	Plays int    `json:"plays"`
+}
+
+const statsTopN = 10
+
+// computeStats fills every bucket in a single pass over plays.
+func computeStats(plays []Playback) statsData {
+	var d statsData
+
+	weekIdx := make(map[string]int)
+	monthIdx := make(map[string]int)
+	artistIdx := make(map[string]int)
+	trackIdx := make(map[string]int)
+
+	for _, play := range plays {
+		d.ByHourOfDay[play.StartTime.Hour()]++
+		d.ByWeekday[play.StartTime.Weekday()]++
+
+		year, week := play.StartTime.ISOWeek()
+		weekLabel := fmt.Sprintf("%04d-W%02d", year, week)
+		if i, ok := weekIdx[weekLabel]; ok {
+			d.ByWeek[i].Plays++
+		} else {
+			weekIdx[weekLabel] = len(d.ByWeek)
+			d.ByWeek = append(d.ByWeek, bucket{Label: weekLabel, Plays: 1})
+		}
+
+		monthLabel := play.StartTime.Format("2006-01")
+		if i, ok := monthIdx[monthLabel]; ok {
+			d.ByMonth[i].Plays++
+		} else {
+			monthIdx[monthLabel] = len(d.ByMonth)
+			d.ByMonth = append(d.ByMonth, bucket{Label: monthLabel, Plays: 1})
+		}
+
+		if i, ok := trackIdx[play.Track.Id]; ok {
+			d.TopTracks[i].Plays++
+		} else {
+			trackIdx[play.Track.Id] = len(d.TopTracks)
+			d.TopTracks = append(d.TopTracks, statsNamed{Name: play.Track.Name, Plays: 1})
+		}
+		for _, artist := range play.Track.Artists {
+			if i, ok := artistIdx[artist.Id]; ok {
+				d.TopArtists[i].Plays++
+			} else {
+				artistIdx[artist.Id] = len(d.TopArtists)
+				d.TopArtists = append(d.TopArtists, statsNamed{Name: artist.Name, Plays: 1})
+			}
+		}
+	}
+
+	sort.Slice(d.ByWeek, func(i, j int) bool { return d.ByWeek[i].Label < d.ByWeek[j].Label })
+	sort.Slice(d.ByMonth, func(i, j int) bool { return d.ByMonth[i].Label < d.ByMonth[j].Label })
+
+	sort.Slice(d.TopArtists, func(i, j int) bool { return d.TopArtists[i].Plays > d.TopArtists[j].Plays })
+	if len(d.TopArtists) > statsTopN {
+		d.TopArtists = d.TopArtists[:statsTopN]
+	}
+	sort.Slice(d.TopTracks, func(i, j int) bool { return d.TopTracks[i].Plays > d.TopTracks[j].Plays })
+	if len(d.TopTracks) > statsTopN {
+		d.TopTracks = d.TopTracks[:statsTopN]
+	}
+
+	return d
+}
+
+func (s *Server) handleStats(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := s.o.T.Start(r.Context(), "handleStats")
+	defer span.End()
+
+	plays := s.getPlaybacks(ctx, optionsFromRequest(r))
+	d := computeStats(plays)
+
+	var buf bytes.Buffer
+	buf.WriteString("### Stats\n\n")
+
+	buf.WriteString("#### plays by hour of day\n\n")
+	buf.WriteString(svgBarChart(d.ByHourOfDay[:], hourLabels()))
+
+	buf.WriteString("\n\n#### plays by weekday\n\n")
+	buf.WriteString(svgBarChart(d.ByWeekday[:], weekdayLabels()))
+
+	buf.WriteString("\n\n#### plays by week\n\n")
+	buf.WriteString(svgLineChart(d.ByWeek))
+
+	buf.WriteString("\n\n#### plays by month\n\n")
+	buf.WriteString(svgLineChart(d.ByMonth))
+
+	buf.WriteString("\n\n#### top artists\n\n")
+	buf.WriteString("<table><thead><tr><th>artist<th>plays</tr></thead>\n<tbody>")
+	for _, a := range d.TopArtists {
+		fmt.Fprintf(&buf, "<tr><td>%s<td>%d</tr>\n", a.Name, a.Plays)
+	}
+	buf.WriteString("</tbody></table>")
+
+	buf.WriteString("\n\n#### top tracks\n\n")
+	buf.WriteString("<table><thead><tr><th>track<th>plays</tr></thead>\n<tbody>")
+	for _, t := range d.TopTracks {
+		fmt.Fprintf(&buf, "<tr><td>%s<td>%d</tr>\n", t.Name, t.Plays)
+	}
+	buf.WriteString("</tbody></table>")
+
+	err := s.render.Render(rw, &buf, webstyle.Data{})
+	if err != nil {
+		s.o.HTTPErr(ctx, "render", err, rw, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleStatsJSON(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := s.o.T.Start(r.Context(), "handleStatsJSON")
+	defer span.End()
+
+	plays := s.getPlaybacks(ctx, optionsFromRequest(r))
+	d := computeStats(plays)
+
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(d); err != nil {
+		s.o.HTTPErr(ctx, "encode", err, rw, http.StatusInternalServerError)
+	}
+}
+
+func hourLabels() []string {
+	labels := make([]string, 24)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("%02d", i)
+	}
+	return labels
+}
+
+func weekdayLabels() []string {
+	return []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+}
+
+const (
+	chartWidth  = 600
+	chartHeight = 120
+	chartBarGap = 2
+)
+
+// svgBarChart renders values as a fixed-width inline SVG bar chart, no JS
+// or external assets required.
+func svgBarChart(values []int, labels []string) string {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	barWidth := float64(chartWidth) / float64(len(values))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`,
+		chartWidth, chartHeight+16, chartWidth, chartHeight+16)
+	for i, v := range values {
+		h := float64(v) / float64(max) * chartHeight
+		x := float64(i) * barWidth
+		fmt.Fprintf(&buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="currentColor"><title>%s: %d</title></rect>`,
+			x+chartBarGap/2, chartHeight-h, barWidth-chartBarGap, h, labels[i], v)
+	}
+	buf.WriteString(`</svg>`)
+	return buf.String()
+}
+
+// svgLineChart renders a bucket series as a fixed-width inline SVG
+// polyline, for longer time series (weeks, months) where bars are too
+// dense to label individually.
+func svgLineChart(buckets []bucket) string {
+	if len(buckets) == 0 {
+		return ""
+	}
+
+	max := 0
+	for _, b := range buckets {
+		if b.Plays > max {
+			max = b.Plays
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	step := float64(chartWidth) / float64(maxInt(len(buckets)-1, 1))
+
+	var points bytes.Buffer
+	for i, b := range buckets {
+		x := float64(i) * step
+		y := chartHeight - float64(b.Plays)/float64(max)*chartHeight
+		if i > 0 {
+			points.WriteString(" ")
+		}
+		fmt.Fprintf(&points, "%.1f,%.1f", x, y)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&buf, `<polyline points="%s" fill="none" stroke="currentColor" stroke-width="2"><title>%s .. %s</title></polyline>`,
+		points.String(), buckets[0].Label, buckets[len(buckets)-1].Label)
+	buf.WriteString(`</svg>`)
+	return buf.String()
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
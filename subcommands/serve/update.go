@@ -2,51 +2,65 @@ package serve
 
 import (
 	"context"
+	"log/slog"
 	"time"
 
 	"github.com/bufbuild/connect-go"
-	"github.com/zmb3/spotify/v2"
 	earbugv4 "go.seankhliao.com/proto/earbug/v4"
-	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 func (s *Server) UpdateRecentlyPlayed(ctx context.Context, r *connect.Request[earbugv4.UpdateRecentlyPlayedRequest]) (*connect.Response[earbugv4.UpdateRecentlyPlayedResponse], error) {
 	_, span := s.o.T.Start(ctx, "UpdateRecentlyPlayed")
 	defer span.End()
 
-	items, err := s.spot.PlayerRecentlyPlayedOpt(ctx, &spotify.RecentlyPlayedOptions{Limit: 50})
+	for _, a := range s.agents {
+		if err := s.updateFromAgent(ctx, a); err != nil {
+			s.o.L.LogAttrs(ctx, slog.LevelError, "update from agent",
+				slog.String("agent", a.Name()),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+	s.scrobblers.Retry(ctx)
+	return &connect.Response[earbugv4.UpdateRecentlyPlayedResponse]{}, nil
+}
+
+// updateFromAgent pulls recently played tracks from a single agent and
+// merges them into the store, keyed by (agent name, start time): an agent
+// re-reporting a play adds nothing, while the same moment reported by two
+// agents is stored once per agent.
+func (s *Server) updateFromAgent(ctx context.Context, a Agent) error {
+	since, _, err := s.store.LastPlaybackTime(ctx, a.Name())
+	if err != nil {
+		return s.o.Err(ctx, "get last playback time", err)
+	}
+
+	plays, err := a.RecentlyPlayed(ctx, since)
 	if err != nil {
-		return nil, s.o.Err(ctx, "get recently played", err)
+		return s.o.Err(ctx, "get recently played", err)
 	}
 
-	for _, item := range items {
-		ts := item.PlayedAt.Format(time.RFC3339Nano)
-		if _, ok := s.store.Playbacks[ts]; !ok {
-			s.store.Playbacks[ts] = &earbugv4.Playback{
-				TrackId:     item.Track.ID.String(),
-				TrackUri:    string(item.Track.URI),
-				ContextType: item.PlaybackContext.Type,
-				ContextUri:  string(item.PlaybackContext.URI),
-			}
+	for _, play := range plays {
+		if err := s.store.PutTrack(ctx, play.Track); err != nil {
+			return s.o.Err(ctx, "put track", err)
+		}
+
+		added, err := s.store.PutPlayback(ctx, a.Name(), play.StartTime, &earbugv4.Playback{
+			TrackId:     play.Track.Id,
+			TrackUri:    play.Track.Uri,
+			ContextType: play.ContextType,
+			ContextUri:  play.ContextURI,
+		})
+		if err != nil {
+			return s.o.Err(ctx, "put playback", err)
+		}
+		if !added {
+			continue
 		}
 
-		if _, ok := s.store.Tracks[item.Track.ID.String()]; !ok {
-			t := &earbugv4.Track{
-				Id:       item.Track.ID.String(),
-				Uri:      string(item.Track.URI),
-				Type:     item.Track.Type,
-				Name:     item.Track.Name,
-				Duration: durationpb.New(item.Track.TimeDuration()),
-			}
-			for _, artist := range item.Track.Artists {
-				t.Artists = append(t.Artists, &earbugv4.Artist{
-					Id:   artist.ID.String(),
-					Uri:  string(artist.URI),
-					Name: artist.Name,
-				})
-			}
-			s.store.Tracks[item.Track.ID.String()] = t
+		if a.Name() == "spotify" {
+			s.scrobblers.Scrobble(ctx, play.StartTime, play.Track)
 		}
 	}
-	return &connect.Response[earbugv4.UpdateRecentlyPlayedResponse]{}, nil
+	return nil
 }
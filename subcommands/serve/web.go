@@ -3,12 +3,14 @@ package serve
 import (
 	"bytes"
 	"context"
+	"log/slog"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"go.seankhliao.com/earbug/v4/store"
 	earbugv4 "go.seankhliao.com/proto/earbug/v4"
 	"go.seankhliao.com/webstyle"
 )
@@ -62,6 +64,8 @@ func (s *Server) handleIndex(rw http.ResponseWriter, r *http.Request) {
 - [playbacks](/playbacks)
 - [tracks by plays](/tracks?sort=plays)
 - [tracks by time](/tracks?sort=time)
+- [stats](/stats)
+- [sessions](/sessions)
 `
 
 	err := s.render.Render(rw, strings.NewReader(c), webstyle.Data{})
@@ -79,6 +83,9 @@ func (s *Server) handleArtists(rw http.ResponseWriter, r *http.Request) {
 		sortOrder = "plays"
 	}
 
+	l := loggerFromContext(ctx, s.o.L)
+	l.LogAttrs(ctx, slog.LevelDebug, "listing artists", slog.String("sort", sortOrder))
+
 	plays := s.getPlaybacks(ctx, optionsFromRequest(r))
 
 	type TrackData struct {
@@ -290,7 +297,12 @@ func (s *Server) handlePlaybacks(rw http.ResponseWriter, r *http.Request) {
 	ctx, span := s.o.T.Start(r.Context(), "handlePlaybacks")
 	defer span.End()
 
-	plays := s.getPlaybacks(ctx, optionsFromRequest(r))
+	o := optionsFromRequest(r)
+	l := loggerFromContext(ctx, s.o.L)
+	l.LogAttrs(ctx, slog.LevelDebug, "listing playbacks",
+		slog.String("artist", o.Artist), slog.String("track", o.Track))
+
+	plays := s.getPlaybacks(ctx, o)
 
 	var buf bytes.Buffer
 	buf.WriteString(`### Playbacks `)
@@ -333,53 +345,30 @@ type Playback struct {
 	StartTime    time.Time
 	PlaybackTime time.Duration
 	Track        *earbugv4.Track
+	ContextURI   string
 }
 
 func (s *Server) getPlaybacks(ctx context.Context, o getPlaybacksOptions) []Playback {
-	_, span := s.o.T.Start(ctx, "getPlaybacks")
+	ctx, span := s.o.T.Start(ctx, "getPlaybacks")
 	defer span.End()
 
-	var plays []Playback
-
-	s.storemu.Lock()
-	defer s.storemu.Unlock()
-	for ts, play := range s.store.Playbacks {
-		startTime, _ := time.Parse(time.RFC3339, ts)
-
-		if !o.From.IsZero() && o.From.After(startTime) {
-			continue
-		} else if !o.To.IsZero() && o.To.Before(startTime) {
-			continue
-		}
-
-		track := s.store.Tracks[play.TrackId]
-
-		if o.Track != "" && !strings.Contains(strings.ToLower(track.Name), strings.ToLower(o.Track)) {
-			continue
-		}
-
-		artistMatch := o.Artist == ""
-		for _, artist := range track.Artists {
-			if !artistMatch && strings.Contains(strings.ToLower(artist.Name), strings.ToLower(o.Artist)) {
-				artistMatch = true
-			}
-		}
-		if !artistMatch {
-			continue
-		}
-
-		plays = append(plays, Playback{
-			StartTime: startTime,
-			Track:     track,
-		})
-	}
-
-	sort.Slice(plays, func(i, j int) bool {
-		return plays[i].StartTime.After(plays[j].StartTime)
+	rows, err := s.store.ListPlaybacks(ctx, store.Options{
+		From:   o.From,
+		To:     o.To,
+		Artist: o.Artist,
+		Track:  o.Track,
 	})
+	if err != nil {
+		s.o.Err(ctx, "list playbacks", err)
+		return nil
+	}
 
-	for i := range plays {
-		plays[i].PlaybackTime = plays[i].Track.Duration.AsDuration()
+	plays := make([]Playback, len(rows))
+	for i, row := range rows {
+		plays[i].StartTime = row.StartTime
+		plays[i].Track = row.Track
+		plays[i].ContextURI = row.ContextURI
+		plays[i].PlaybackTime = row.Track.Duration.AsDuration()
 		if i > 0 {
 			gap := plays[i-1].StartTime.Sub(plays[i].StartTime)
 			if gap < plays[i].PlaybackTime {
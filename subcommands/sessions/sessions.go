@@ -0,0 +1,163 @@
+// Package sessions groups recent listening history into sessions and
+// prints a summary, the client-side equivalent of the serve package's
+// /sessions handler.
+//
+// The earbugv4 proto is generated outside this repo and there's no
+// .proto source here to add a ListSessions RPC to, so this fetches the
+// same window of plays as the report subcommand via the existing
+// ReportPlayed RPC and groups them client-side. ReportPlayedResponse_Playback
+// also carries no context (playlist/album) field, so unlike /sessions's
+// HTML table, the printed summary has no dominant-context column.
+package sessions
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/google/subcommands"
+	"go.seankhliao.com/earbug/v4/client"
+	earbugv4 "go.seankhliao.com/proto/earbug/v4"
+	"go.seankhliao.com/svcrunner/v2/observability"
+	"golang.org/x/exp/slog"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Cmd struct {
+	o observability.Config
+	c client.Config
+
+	since   *timestamppb.Timestamp
+	idleGap time.Duration
+}
+
+func (c *Cmd) Name() string     { return `sessions` }
+func (c *Cmd) Synopsis() string { return `summarize recent data as listening sessions` }
+func (c *Cmd) Usage() string {
+	return `sessions [options...]
+
+group recent listening history into sessions and print a summary.
+
+Flags:
+`
+}
+
+func (c *Cmd) SetFlags(f *flag.FlagSet) {
+	c.o.SetFlags(f)
+	c.c.SetFlags(f)
+
+	f.Func("since", "report data since", func(s string) error {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		c.since = timestamppb.New(t)
+		return nil
+	})
+	f.DurationVar(&c.idleGap, "idle-gap", 30*time.Minute, "gap between plays after which a new session starts")
+}
+
+func (c *Cmd) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	o := observability.New(c.o)
+	e := client.New(c.c)
+
+	ctx, span := o.T.Start(ctx, "sessions")
+	defer span.End()
+
+	res, err := e.ReportPlayed(ctx, &connect.Request[earbugv4.ReportPlayedRequest]{
+		Msg: &earbugv4.ReportPlayedRequest{
+			Since: c.since,
+		},
+	})
+	if err != nil {
+		o.L.LogAttrs(ctx, slog.LevelError, "get recently played", slog.String("error", err.Error()))
+		return subcommands.ExitFailure
+	}
+
+	sessions := computeSessions(res.Msg.Playbacks, c.idleGap)
+	for _, s := range sessions {
+		fmt.Printf("%s\t%s\t%s\t%d plays\t%d artists\t%d tracks\n",
+			s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339), s.ListenTime,
+			s.Plays, s.DistinctArtists, s.DistinctTracks)
+	}
+
+	return subcommands.ExitSuccess
+}
+
+type session struct {
+	Start           time.Time
+	End             time.Time
+	ListenTime      time.Duration
+	Plays           int
+	DistinctArtists int
+	DistinctTracks  int
+}
+
+// computeSessions groups plays (sorted newest first, as ReportPlayed
+// returns them) into sessions separated by more than idleGap of
+// inactivity. Playbacks carry no duration, so a play's contribution to
+// ListenTime is the gap to the next play, capped at idleGap (the last play
+// counts as idleGap); unlike main.go's and serve's getPlaybacks, no track
+// duration bounds it.
+func computeSessions(plays []*earbugv4.ReportPlayedResponse_Playback, idleGap time.Duration) []session {
+	if len(plays) == 0 {
+		return nil
+	}
+
+	chrono := make([]*earbugv4.ReportPlayedResponse_Playback, len(plays))
+	copy(chrono, plays)
+	sort.SliceStable(chrono, func(i, j int) bool {
+		return chrono[i].StartTime.AsTime().Before(chrono[j].StartTime.AsTime())
+	})
+
+	var sessions []session
+	var cur *session
+	artists := map[string]bool{}
+	tracks := map[string]bool{}
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.DistinctArtists = len(artists)
+		cur.DistinctTracks = len(tracks)
+		sessions = append(sessions, *cur)
+		cur = nil
+		artists = map[string]bool{}
+		tracks = map[string]bool{}
+	}
+
+	var prevEnd time.Time
+	for i, p := range chrono {
+		start := p.StartTime.AsTime()
+		if cur != nil && start.Sub(prevEnd) > idleGap {
+			flush()
+		}
+		if cur == nil {
+			cur = &session{Start: start}
+		}
+		listen := idleGap
+		if i+1 < len(chrono) {
+			if gap := chrono[i+1].StartTime.AsTime().Sub(start); gap < listen {
+				listen = gap
+			}
+		}
+		cur.End = start.Add(listen)
+		cur.ListenTime += listen
+		cur.Plays++
+		tracks[p.Track.Id] = true
+		for _, artist := range p.Artists {
+			artists[artist.Id] = true
+		}
+		prevEnd = cur.End
+	}
+	flush()
+
+	for i, j := 0, len(sessions)-1; i < j; i, j = i+1, j-1 {
+		sessions[i], sessions[j] = sessions[j], sessions[i]
+	}
+	return sessions
+}